@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+	"tv/conf"
+	"tv/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cache 缓存存储后端
+// 后端只负责按 Key 存取条目，过期判断、TTL 和类型区分由 SearchCache 处理
+type Cache interface {
+	// Get 读取条目，不判断是否过期
+	Get(key string) (Item, bool)
+	Set(key string, item Item) error
+	Delete(key string) bool
+	// DeletePrefix 删除指定前缀的条目，prefix 为空时清空全部，返回删除数量
+	DeletePrefix(prefix string) int
+	// Scan 遍历所有条目的 Key 和过期时间，回调中不能再调用后端的写方法
+	Scan(fn func(key string, expiresAt time.Time))
+	Len() int
+	Close() error
+}
+
+// 缓存条目
+// StaleAt 之前为新鲜数据；StaleAt 到 ExpiresAt 之间为旧数据，仍可返回但需要刷新
+type Item struct {
+	Data      models.APIResponse
+	StaleAt   time.Time // 零值表示与 ExpiresAt 相同
+	ExpiresAt time.Time
+}
+
+// 是否已过软过期时间
+func (i Item) isStale(now time.Time) bool {
+	return !i.StaleAt.IsZero() && now.After(i.StaleAt)
+}
+
+// 根据 cache.backend 配置创建存储后端
+func newBackend(cfg *conf.Config) (Cache, error) {
+	backend := cfg.Cache.Backend
+	switch backend.Type {
+	case "", "memory":
+		return newMemoryCache(limitsOf(cfg)), nil
+	case "disk":
+		path := backend.Path
+		if path == "" {
+			path = filepath.Join(cfg.App.DataDir, "cache.db")
+		}
+		return newDiskCache(path)
+	case "redis":
+		return newRedisCache(backend.RedisURL, backend.RedisPrefix)
+	default:
+		return nil, fmt.Errorf("不支持的缓存后端: %s", backend.Type)
+	}
+}
+
+// 可调整容量限制的后端（内存缓存）
+type limiter interface {
+	SetLimits(limits Limits)
+	Stats() map[string]any
+}
+
+func limitsOf(cfg *conf.Config) Limits {
+	l := cfg.Cache.Limits
+	return Limits{
+		MaxEntries: l.MaxEntries,
+		MaxBytes:   int64(l.MaxMemoryMB) << 20,
+		Quotas:     l.Quotas,
+	}
+}
+
+// ============ 序列化 ============
+
+// 持久化后端保存的响应内容，过期时间由后端自行保存
+type storedResponse struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Extra   json.RawMessage `json:"extra,omitempty"`
+	StaleAt int64           `json:"stale_at,omitempty"` // UnixNano，旧版本写入的条目没有该字段
+}
+
+func encodeItem(item Item) ([]byte, error) {
+	var staleAt int64
+	if !item.StaleAt.IsZero() {
+		staleAt = item.StaleAt.UnixNano()
+	}
+	return json.Marshal(struct {
+		models.APIResponse
+		StaleAt int64 `json:"stale_at,omitempty"`
+	}{item.Data, staleAt})
+}
+
+// 反序列化时按缓存类型还原 Data 的具体类型，保证与内存后端返回的类型一致
+// （详情接口命中缓存后还需要按 models.VodItem 处理播放线路和下一集）
+// 返回的 Item 不包含 ExpiresAt
+func decodeItem(key string, b []byte) (Item, error) {
+	var stored storedResponse
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return Item{}, err
+	}
+	resp, err := decodeResponse(key, stored)
+	item := Item{Data: resp}
+	if stored.StaleAt > 0 {
+		item.StaleAt = time.Unix(0, stored.StaleAt)
+	}
+	return item, err
+}
+
+func decodeResponse(key string, stored storedResponse) (models.APIResponse, error) {
+	resp := models.APIResponse{Code: stored.Code, Message: stored.Message}
+
+	switch CacheType(keyType(key)) {
+	case CacheTypeSearch:
+		var items []models.VodItem
+		if err := json.Unmarshal(stored.Data, &items); err != nil {
+			return resp, err
+		}
+		resp.Data = items
+	case CacheTypeID:
+		var item models.VodItem
+		if err := json.Unmarshal(stored.Data, &item); err != nil {
+			return resp, err
+		}
+		resp.Data = item
+	default:
+		var data any
+		if err := json.Unmarshal(stored.Data, &data); err != nil {
+			return resp, err
+		}
+		if m, ok := data.(map[string]any); ok {
+			data = gin.H(m)
+		}
+		resp.Data = data
+	}
+
+	if len(stored.Extra) > 0 {
+		var extra any
+		if err := json.Unmarshal(stored.Extra, &extra); err != nil {
+			return resp, err
+		}
+		if m, ok := extra.(map[string]any); ok {
+			extra = gin.H(m)
+		}
+		resp.Extra = extra
+	}
+	return resp, nil
+}
@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+	"tv/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func newTestDisk(t *testing.T) *diskCache {
+	t.Helper()
+	d, err := newDiskCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func newTestRedis(t *testing.T) (*redisCache, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	r, err := newRedisCache("redis://"+srv.Addr(), "ytv:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r, srv
+}
+
+// Data 的具体类型和 JSON 内容都一致（VodItem 的部分字段序列化后会规范化）
+func sameResponse(got, want models.APIResponse) bool {
+	if reflect.TypeOf(got.Data) != reflect.TypeOf(want.Data) {
+		return false
+	}
+	a, _ := json.Marshal(got)
+	b, _ := json.Marshal(want)
+	return string(a) == string(b) && reflect.DeepEqual(got.Extra, want.Extra)
+}
+
+func scanKeys(c Cache) []string {
+	var keys []string
+	c.Scan(func(key string, _ time.Time) { keys = append(keys, key) })
+	sort.Strings(keys)
+	return keys
+}
+
+// 各后端共同的存取行为
+func testBackend(t *testing.T, c Cache) {
+	now := time.Now()
+	item := Item{
+		Data: models.APIResponse{
+			Code:    200,
+			Message: "ok",
+			Data:    []models.VodItem{{SourceKey: "a", VodID: 1, VodName: "剧名"}},
+			Extra:   gin.H{"total": float64(1)},
+		},
+		StaleAt:   now.Add(time.Minute),
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if err := c.Set("search|剧名", item); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := c.Get("search|剧名")
+	if !ok {
+		t.Fatal("Get after Set missed")
+	}
+	if !sameResponse(got.Data, item.Data) {
+		t.Errorf("Data = %#v, want %#v", got.Data, item.Data)
+	}
+	if !got.StaleAt.Equal(item.StaleAt) {
+		t.Errorf("StaleAt = %s, want %s", got.StaleAt, item.StaleAt)
+	}
+	if d := got.ExpiresAt.Sub(item.ExpiresAt); d < -time.Second || d > time.Second {
+		t.Errorf("ExpiresAt = %s, want %s", got.ExpiresAt, item.ExpiresAt)
+	}
+	if _, ok := c.Get("search|missing"); ok {
+		t.Error("Get of missing key hit")
+	}
+
+	for _, key := range []string{"search|剧名2", "search|*", "search|[a]", "id|a|1", "hot|movie"} {
+		if err := c.Set(key, testItem(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"hot|movie", "id|a|1", "search|*", "search|[a]", "search|剧名", "search|剧名2"}
+	if keys := scanKeys(c); !reflect.DeepEqual(keys, want) {
+		t.Errorf("Scan = %v, want %v", keys, want)
+	}
+	if c.Len() != len(want) {
+		t.Errorf("Len = %d, want %d", c.Len(), len(want))
+	}
+
+	if !c.Delete("hot|movie") || c.Delete("hot|movie") {
+		t.Error("Delete should report whether the key existed")
+	}
+	// 通配符按字面匹配，不会删除其他关键词
+	if n := c.DeletePrefix("search|*"); n != 1 {
+		t.Errorf("DeletePrefix(search|*) = %d, want 1", n)
+	}
+	if n := c.DeletePrefix("search|[a]"); n != 1 {
+		t.Errorf("DeletePrefix(search|[a]) = %d, want 1", n)
+	}
+	if n := c.DeletePrefix("search|剧名"); n != 2 {
+		t.Errorf("DeletePrefix(search|剧名) = %d, want 2", n)
+	}
+	if keys := scanKeys(c); !reflect.DeepEqual(keys, []string{"id|a|1"}) {
+		t.Errorf("Scan after delete = %v", keys)
+	}
+	if n := c.DeletePrefix(""); n != 1 || c.Len() != 0 {
+		t.Errorf("DeletePrefix(\"\") = %d, Len = %d", n, c.Len())
+	}
+}
+
+func TestDiskBackend(t *testing.T) {
+	testBackend(t, newTestDisk(t))
+}
+
+func TestDiskBackendPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	d, err := newDiskCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Set("id|a|1", Item{Data: models.APIResponse{Data: models.VodItem{VodID: 1}}, ExpiresAt: time.Now().Add(time.Hour)})
+	d.Close()
+
+	d, err = newDiskCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	item, ok := d.Get("id|a|1")
+	if !ok {
+		t.Fatal("entry lost after reopen")
+	}
+	if v, ok := item.Data.Data.(models.VodItem); !ok || v.VodID != 1 {
+		t.Errorf("Data = %#v, want models.VodItem", item.Data.Data)
+	}
+}
+
+func TestRedisBackend(t *testing.T) {
+	r, _ := newTestRedis(t)
+	testBackend(t, r)
+}
+
+func TestRedisBackendExpiry(t *testing.T) {
+	r, srv := newTestRedis(t)
+
+	r.Set("search|a", testItem("a"))
+	if !srv.Exists("ytv:search|a") {
+		t.Fatal("key not written with prefix")
+	}
+	// 过期时间交给 Redis 处理
+	srv.FastForward(2 * time.Hour)
+	if _, ok := r.Get("search|a"); ok {
+		t.Error("expired entry still returned")
+	}
+
+	// 已过期的条目不写入
+	r.Set("search|b", Item{Data: models.APIResponse{Data: "b"}, ExpiresAt: time.Now().Add(-time.Second)})
+	if srv.Exists("ytv:search|b") {
+		t.Error("expired item written")
+	}
+
+	// 其他前缀的 Key 不受影响
+	srv.Set("other:search|a", "x")
+	if n := r.DeletePrefix(""); n != 0 || !srv.Exists("other:search|a") {
+		t.Errorf("DeletePrefix touched keys outside the prefix")
+	}
+}
+
+func TestDecodeItem(t *testing.T) {
+	tests := []struct {
+		key  string
+		item Item
+	}{
+		{"search|k", Item{Data: models.APIResponse{Data: []models.VodItem{{SourceKey: "a", VodID: 1}}}}},
+		{"id|a|1", Item{Data: models.APIResponse{Data: models.VodItem{SourceKey: "a", VodID: 1}}}},
+		{"hot|movie", Item{Data: models.APIResponse{Data: gin.H{"list": []any{"x"}}, Extra: gin.H{"n": float64(1)}}}},
+		{"hot|tv", Item{Data: models.APIResponse{Data: "text"}, StaleAt: time.Unix(0, 1700000000000000000)}},
+	}
+	for _, tt := range tests {
+		body, err := encodeItem(tt.item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decodeItem(tt.key, body)
+		if err != nil {
+			t.Fatalf("decodeItem(%s): %v", tt.key, err)
+		}
+		if !sameResponse(got.Data, tt.item.Data) || !got.StaleAt.Equal(tt.item.StaleAt) {
+			t.Errorf("decodeItem(%s) = %#v, want %#v", tt.key, got, tt.item)
+		}
+	}
+
+	// Data 类型与缓存类型不符时返回错误
+	body, _ := encodeItem(Item{Data: models.APIResponse{Data: "text"}})
+	if _, err := decodeItem("search|k", body); err == nil {
+		t.Error("decodeItem accepted a string for a search entry")
+	}
+	if _, err := decodeItem("search|k", []byte("{")); err == nil {
+		t.Error("decodeItem accepted invalid JSON")
+	}
+}
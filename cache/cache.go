@@ -1,13 +1,23 @@
 package cache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 	"tv/conf"
+	"tv/metrics"
 	"tv/models"
+	"tv/tracing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -17,32 +27,50 @@ var (
 
 func GetCacher() *SearchCache {
 	once.Do(func() {
+		cfg := conf.Get()
+
+		backend := cfg.Cache.Backend.Type
+		store, err := newBackend(cfg)
+		if err != nil {
+			log.Error().Err(err).Str("backend", backend).Msg("缓存后端初始化失败，改用内存缓存")
+			backend, store = "memory", newMemoryCache(limitsOf(cfg))
+		}
+
+		ttl, stale := ttlsOf(cfg)
 		instance = &SearchCache{
-			items: make(map[string]cacheItem),
-			ttl: map[CacheType]time.Duration{
-				CacheTypeSearch: conf.Cfg.Cache.Search,
-				CacheTypeID:     conf.Cfg.Cache.ID,
-				CacheTypeHot:    conf.Cfg.Cache.Hot,
-			},
+			store:    store,
+			backend:  backend,
+			ttl:      ttl,
+			stale:    stale,
+			negative: cfg.Cache.Negative,
 		}
 
 		log.Info().
-			Dur("search", instance.ttl[CacheTypeSearch]).
-			Dur("id", instance.ttl[CacheTypeID]).
-			Dur("hot", instance.ttl[CacheTypeHot]).
+			Str("backend", backend).
+			Dur("search", ttl[CacheTypeSearch]).
+			Dur("id", ttl[CacheTypeID]).
+			Dur("hot", ttl[CacheTypeHot]).
+			Dur("stale_search", stale[CacheTypeSearch]).
+			Dur("stale_id", stale[CacheTypeID]).
+			Dur("stale_hot", stale[CacheTypeHot]).
+			Dur("negative", cfg.Cache.Negative).
 			Msg("搜索缓存已就绪")
 
+		// 配置热加载时同步缓存时间和容量限制
+		conf.OnReload(func(cfg *conf.Config, _ []string) {
+			instance.SetTTL(ttlsOf(cfg))
+			instance.SetNegativeTTL(cfg.Cache.Negative)
+			if l, ok := instance.store.(limiter); ok {
+				l.SetLimits(limitsOf(cfg))
+			}
+		})
+
 		// 启动定期清理协程
 		go instance.startCleanup()
 	})
 	return instance
 }
 
-type cacheItem struct {
-	data      models.APIResponse
-	expiresAt time.Time
-}
-
 // 定义缓存类型
 type CacheType string
 
@@ -52,68 +80,162 @@ const (
 	CacheTypeHot    CacheType = "hot"
 )
 
+// SearchCache 按类型区分缓存时间的响应缓存，数据存放在可替换的存储后端中
+// 超过缓存时间（软过期）后条目再保留 stale 时长（硬过期），期间返回旧数据并在后台刷新
 type SearchCache struct {
-	sync.RWMutex
-	items map[string]cacheItem
-	ttl   map[CacheType]time.Duration
+	sync.RWMutex // 保护 ttl、stale 和 negative
+	store        Cache
+	backend      string
+	ttl          map[CacheType]time.Duration
+	stale        map[CacheType]time.Duration
+	negative     time.Duration // 失败结果的缓存时间
+	flight       flightGroup
+
+	refreshErrors sync.Map // Key -> 最近一次后台刷新的错误
+}
+
+// 从配置读取各类缓存的缓存时间和旧数据保留时间
+func ttlsOf(cfg *conf.Config) (ttl, stale map[CacheType]time.Duration) {
+	ttl = map[CacheType]time.Duration{
+		CacheTypeSearch: cfg.Cache.Search,
+		CacheTypeID:     cfg.Cache.ID,
+		CacheTypeHot:    cfg.Cache.Hot,
+	}
+	stale = map[CacheType]time.Duration{
+		CacheTypeSearch: cfg.Cache.Stale.Search,
+		CacheTypeID:     cfg.Cache.Stale.ID,
+		CacheTypeHot:    cfg.Cache.Stale.Hot,
+	}
+	return ttl, stale
 }
 
 // ============ 通用缓存操作 ============
 
-// 获取缓存
+// 获取未软过期的缓存
 func (c *SearchCache) get(key string) (models.APIResponse, bool) {
-	c.RLock()
-	defer c.RUnlock()
-
-	item, exists := c.items[key]
-
+	item, exists := c.lookup(key)
 	if !exists {
-		log.Debug().
-			Str("key", key).
-			Int("total_items", len(c.items)).
-			Msg("缓存 Key 不存在")
 		return models.APIResponse{}, false
 	}
 
 	now := time.Now()
-	if now.After(item.expiresAt) {
+	if item.isStale(now) {
 		log.Debug().
 			Str("key", key).
-			Time("expired_at", item.expiresAt).
-			Time("now", now).
-			Dur("expired_for", now.Sub(item.expiresAt)).
+			Time("stale_at", item.StaleAt).
+			Dur("stale_for", now.Sub(item.StaleAt)).
 			Msg("缓存已过期")
 		return models.APIResponse{}, false
 	}
 
 	log.Debug().
 		Str("key", key).
-		Time("expires_at", item.expiresAt).
-		Dur("remaining", item.expiresAt.Sub(now)).
+		Time("expires_at", item.ExpiresAt).
+		Dur("remaining", item.ExpiresAt.Sub(now)).
 		Msg("缓存命中")
 
-	return item.data, true
+	return item.Data, true
+}
+
+// 获取未硬过期的缓存条目（可能已软过期）
+func (c *SearchCache) lookup(key string) (Item, bool) {
+	item, exists := c.store.Get(key)
+	typ := keyType(key)
+
+	if !exists {
+		log.Debug().
+			Str("key", key).
+			Msg("缓存 Key 不存在")
+		metrics.CacheMiss(typ)
+		return Item{}, false
+	}
+
+	now := time.Now()
+	if now.After(item.ExpiresAt) {
+		log.Debug().
+			Str("key", key).
+			Time("expired_at", item.ExpiresAt).
+			Time("now", now).
+			Dur("expired_for", now.Sub(item.ExpiresAt)).
+			Msg("缓存已过期")
+		metrics.CacheMiss(typ)
+		return Item{}, false
+	}
+	metrics.CacheHit(typ, item.isStale(now))
+	return item, true
 }
 
 // 设置缓存
-func (c *SearchCache) set(key string, data models.APIResponse, ttl time.Duration) {
-	c.Lock()
-	defer c.Unlock()
+func (c *SearchCache) set(key string, data models.APIResponse, cacheType CacheType) {
+	ttl, stale := c.ttlOf(cacheType)
+	c.setTTL(key, data, ttl, stale)
+}
+
+// 缓存失败结果，到期后直接失效，不保留旧数据
+func (c *SearchCache) setNegative(key string, data models.APIResponse) {
+	c.RLock()
+	ttl := c.negative
+	c.RUnlock()
+	if ttl <= 0 {
+		return
+	}
+	c.setTTL(key, data, ttl, 0)
+}
 
-	expiresAt := time.Now().Add(ttl)
-	c.items[key] = cacheItem{
-		data:      data,
-		expiresAt: expiresAt,
+func (c *SearchCache) setTTL(key string, data models.APIResponse, ttl, stale time.Duration) {
+	staleAt := time.Now().Add(ttl)
+	expiresAt := staleAt.Add(stale)
+	c.refreshErrors.Delete(key)
+
+	if err := c.store.Set(key, Item{Data: data, StaleAt: staleAt, ExpiresAt: expiresAt}); err != nil {
+		log.Error().
+			Err(err).
+			Str("key", key).
+			Str("backend", c.backend).
+			Msg("写入缓存失败")
+		return
 	}
 
 	log.Debug().
 		Str("key", key).
 		Dur("ttl", ttl).
+		Dur("stale", stale).
 		Time("expires_at", expiresAt).
-		Int("total_items", len(c.items)).
 		Msg("缓存已设置")
 }
 
+// 获取某类缓存的缓存时间和旧数据保留时间
+func (c *SearchCache) ttlOf(cacheType CacheType) (ttl, stale time.Duration) {
+	c.RLock()
+	defer c.RUnlock()
+	return c.ttl[cacheType], c.stale[cacheType]
+}
+
+// SetTTL 更新各类缓存的缓存时间和旧数据保留时间，已缓存的条目保持原有过期时间
+func (c *SearchCache) SetTTL(ttl, stale map[CacheType]time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.ttl = ttl
+	c.stale = stale
+
+	log.Info().
+		Dur("search", ttl[CacheTypeSearch]).
+		Dur("id", ttl[CacheTypeID]).
+		Dur("hot", ttl[CacheTypeHot]).
+		Dur("stale_search", stale[CacheTypeSearch]).
+		Dur("stale_id", stale[CacheTypeID]).
+		Dur("stale_hot", stale[CacheTypeHot]).
+		Msg("缓存时间已更新")
+}
+
+// SetNegativeTTL 更新失败结果的缓存时间
+func (c *SearchCache) SetNegativeTTL(ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.negative = ttl
+}
+
 // ============ Key 生成器 ============
 
 // key生成器
@@ -132,6 +254,112 @@ func makeKey(cacheType CacheType, parts ...any) string {
 	return key
 }
 
+// 读取缓存，未命中时调用 fn 并写入缓存
+//   - 未软过期：直接返回
+//   - 已软过期未硬过期：返回旧数据（Extra 中标记 stale），后台调用 fn 刷新；刷新失败时继续返回旧数据直到硬过期
+//   - 不存在或已硬过期：合并相同 Key 的并发请求，等待中的请求共享第一个请求的结果（包括错误）
+func (c *SearchCache) fetch(ctx context.Context, key string, cacheType CacheType, fn func(context.Context) (models.APIResponse, error)) (resp models.APIResponse, err error) {
+	ctx, span := startSpan(ctx, key)
+	defer func() { tracing.End(span, err) }()
+
+	load := func(ctx context.Context) (models.APIResponse, error) {
+		resp, err := fn(ctx)
+		if err == nil {
+			c.set(key, resp, cacheType)
+		}
+		return resp, err
+	}
+
+	if item, ok := c.lookup(key); ok {
+		if !item.isStale(time.Now()) {
+			span.SetAttributes(attribute.String("cache.result", "hit"))
+			return item.Data, nil
+		}
+		span.SetAttributes(attribute.String("cache.result", "stale"))
+		c.revalidate(ctx, key, load)
+		return c.markStale(key, item), nil
+	}
+
+	resp, err, shared := c.flight.do(ctx, key, load)
+	span.SetAttributes(attribute.String("cache.result", "miss"), attribute.Bool("cache.coalesced", shared))
+	return resp, err
+}
+
+// 缓存读取的 Span，未命中时上游请求的 Span 位于其下
+func startSpan(ctx context.Context, key string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "cache.fetch",
+		attribute.String("cache.type", keyType(key)),
+		attribute.String("cache.key", key),
+	)
+}
+
+// 返回给客户端的错误说明：错误提供了 ClientMessage 时使用它，否则不透露原始错误
+func clientMessage(err error) string {
+	var e interface{ ClientMessage() string }
+	if errors.As(err, &e) {
+		return e.ClientMessage()
+	}
+	return "后台刷新失败"
+}
+
+// 后台刷新已软过期的条目，失败时记录错误并保留旧数据
+// 刷新不随请求结束而取消，Span 仍属于触发刷新的请求
+func (c *SearchCache) revalidate(ctx context.Context, key string, load func(context.Context) (models.APIResponse, error)) {
+	c.flight.goDo(ctx, key, func(ctx context.Context) (models.APIResponse, error) {
+		ctx, span := tracing.Start(ctx, "cache.revalidate", attribute.String("cache.key", key))
+		start := time.Now()
+		resp, err := load(ctx)
+		tracing.End(span, err)
+		if err != nil {
+			c.refreshErrors.Store(key, clientMessage(err))
+			log.Warn().
+				Err(err).
+				Str("key", key).
+				Msg("后台刷新缓存失败，继续返回旧数据")
+			return resp, err
+		}
+
+		log.Debug().
+			Str("key", key).
+			Dur("duration", time.Since(start)).
+			Msg("后台刷新缓存完成")
+		return resp, nil
+	})
+}
+
+// 复制旧数据并在 Extra 中标记 stale，不修改缓存中的原对象
+func (c *SearchCache) markStale(key string, item Item) models.APIResponse {
+	extra := gin.H{}
+	switch e := item.Data.Extra.(type) {
+	case nil:
+	case gin.H:
+		maps.Copy(extra, e)
+	case map[string]any:
+		maps.Copy(extra, e)
+	case map[string]string:
+		for k, v := range e {
+			extra[k] = v
+		}
+	default:
+		extra["extra"] = e
+	}
+	extra["stale"] = true
+	extra["stale_at"] = item.StaleAt
+	if msg, ok := c.refreshErrors.Load(key); ok {
+		extra["refresh_error"] = msg
+	}
+
+	log.Debug().
+		Str("key", key).
+		Time("stale_at", item.StaleAt).
+		Time("expires_at", item.ExpiresAt).
+		Msg("返回已过期的缓存数据")
+
+	resp := item.Data
+	resp.Extra = extra
+	return resp
+}
+
 // ============ 热搜缓存 ============
 
 type HotParams struct {
@@ -142,32 +370,114 @@ type HotParams struct {
 	PageStart string
 }
 
+func (p HotParams) key() string {
+	return makeKey(CacheTypeHot, p.Type, p.Tag, p.Sort, p.PageLimit, p.PageStart)
+}
+
 func (c *SearchCache) GetHot(params HotParams) (models.APIResponse, bool) {
-	key := makeKey(CacheTypeHot, params.Type, params.Tag, params.Sort, params.PageLimit, params.PageStart)
-	return c.get(key)
+	return c.get(params.key())
 }
 
 func (c *SearchCache) SetHot(params HotParams, data models.APIResponse) {
-	key := makeKey(CacheTypeHot, params.Type, params.Tag, params.Sort, params.PageLimit, params.PageStart)
-	c.set(key, data, c.ttl[CacheTypeHot])
+	c.set(params.key(), data, CacheTypeHot)
+}
+
+// FetchHot 合并相同参数的并发热门请求，成功后写入缓存
+func (c *SearchCache) FetchHot(ctx context.Context, params HotParams, fn func(context.Context) (models.APIResponse, error)) (models.APIResponse, error) {
+	return c.fetch(ctx, params.key(), CacheTypeHot, fn)
 }
 
 // ============ 关键词搜索缓存 ============
+// 按视频源分别缓存，合并后的响应每次由各源的结果重新组合，一个源失败不影响其他源的缓存
 
 type SearchParams struct {
-	Keyword      string
-	Page         string
-	IncludeAdult bool
+	SourceKey string
+	Keyword   string
+	Page      string
+}
+
+func (p SearchParams) key() string {
+	return makeKey(CacheTypeSearch, p.SourceKey, p.Keyword, p.Page)
+}
+
+// SearchEntry 单个视频源的搜索结果
+type SearchEntry struct {
+	Items []models.VodItem
+	Error string // 非空表示请求失败（失败结果只缓存 cache.negative）
+	Stale bool   // 已过缓存时间，正在后台刷新
+}
+
+// FetchSearch 读取单个视频源的搜索结果，未命中时调用 fn
+// 成功结果缓存 cache.search，失败结果缓存 cache.negative；相同参数的并发请求只调用一次 fn
+func (c *SearchCache) FetchSearch(ctx context.Context, params SearchParams, fn func(context.Context) ([]models.VodItem, error)) (entry SearchEntry) {
+	key := params.key()
+	ctx, span := startSpan(ctx, key)
+	defer func() {
+		var err error
+		if entry.Error != "" {
+			err = errors.New(entry.Error)
+		}
+		tracing.End(span, err)
+	}()
+
+	load := func(ctx context.Context) (models.APIResponse, error) {
+		items, err := fn(ctx)
+		if err != nil {
+			return models.APIResponse{}, err
+		}
+		resp := models.APIResponse{Data: items}
+		c.set(key, resp, CacheTypeSearch)
+		return resp, nil
+	}
+
+	if item, ok := c.lookup(key); ok {
+		entry := searchEntryOf(item.Data)
+		switch {
+		case item.isStale(time.Now()):
+			// 后台刷新失败时不写入失败结果，继续使用旧数据
+			span.SetAttributes(attribute.String("cache.result", "stale"))
+			c.revalidate(ctx, key, load)
+			entry.Stale = true
+		case entry.Error != "":
+			span.SetAttributes(attribute.String("cache.result", "negative"))
+		default:
+			span.SetAttributes(attribute.String("cache.result", "hit"))
+		}
+		return entry
+	}
+
+	resp, err, shared := c.flight.do(ctx, key, func(ctx context.Context) (models.APIResponse, error) {
+		resp, err := load(ctx)
+		// 所有等待的请求都已离开或服务正在退出时不记录失败结果
+		if err != nil && ctx.Err() == nil {
+			resp = models.APIResponse{Code: 1, Message: err.Error()}
+			c.setNegative(key, resp)
+		}
+		return resp, err
+	})
+	span.SetAttributes(attribute.String("cache.result", "miss"), attribute.Bool("cache.coalesced", shared))
+	if err != nil {
+		return SearchEntry{Error: err.Error()}
+	}
+	return searchEntryOf(resp)
 }
 
-func (c *SearchCache) GetKeyword(params SearchParams) (models.APIResponse, bool) {
-	key := makeKey(CacheTypeSearch, params.Keyword, params.Page, params.IncludeAdult)
-	return c.get(key)
+// DeleteSearch 删除单个视频源的搜索结果
+func (c *SearchCache) DeleteSearch(params SearchParams) bool {
+	return c.store.Delete(params.key())
 }
 
-func (c *SearchCache) SetKeyword(params SearchParams, data models.APIResponse) {
-	key := makeKey(CacheTypeSearch, params.Keyword, params.Page, params.IncludeAdult)
-	c.set(key, data, c.ttl[CacheTypeSearch])
+// ClearSearchSource 删除某个视频源的全部搜索结果，返回删除数量
+func (c *SearchCache) ClearSearchSource(sourceKey string) int {
+	return c.store.DeletePrefix(string(CacheTypeSearch) + "|" + sourceKey + "|")
+}
+
+func searchEntryOf(resp models.APIResponse) SearchEntry {
+	if resp.Code != 0 {
+		return SearchEntry{Error: resp.Message}
+	}
+	items, _ := resp.Data.([]models.VodItem)
+	return SearchEntry{Items: items}
 }
 
 // ============ ID搜索缓存 ============
@@ -178,14 +488,21 @@ type IDParams struct {
 	Index     string
 }
 
+func (p IDParams) key() string {
+	return makeKey(CacheTypeID, p.SourceKey, p.VodID, p.Index)
+}
+
 func (c *SearchCache) GetByID(params IDParams) (models.APIResponse, bool) {
-	key := makeKey(CacheTypeID, params.SourceKey, params.VodID, params.Index)
-	return c.get(key)
+	return c.get(params.key())
 }
 
 func (c *SearchCache) SetByID(params IDParams, data models.APIResponse) {
-	key := makeKey(CacheTypeID, params.SourceKey, params.VodID, params.Index)
-	c.set(key, data, c.ttl[CacheTypeID])
+	c.set(params.key(), data, CacheTypeID)
+}
+
+// FetchByID 合并相同参数的并发详情请求，成功后写入缓存
+func (c *SearchCache) FetchByID(ctx context.Context, params IDParams, fn func(context.Context) (models.APIResponse, error)) (models.APIResponse, error) {
+	return c.fetch(ctx, params.key(), CacheTypeID, fn)
 }
 
 // ============ 清理过期缓存 ============
@@ -210,14 +527,17 @@ func (c *SearchCache) startCleanup() {
 
 // CleanExpired 清理所有过期的缓存项
 func (c *SearchCache) CleanExpired() int {
-	c.Lock()
-	defer c.Unlock()
-
 	now := time.Now()
+	var expired []string
+	c.store.Scan(func(key string, expiresAt time.Time) {
+		if now.After(expiresAt) {
+			expired = append(expired, key)
+		}
+	})
+
 	count := 0
-	for key, item := range c.items {
-		if now.After(item.expiresAt) {
-			delete(c.items, key)
+	for _, key := range expired {
+		if c.store.Delete(key) {
 			count++
 		}
 	}
@@ -225,7 +545,6 @@ func (c *SearchCache) CleanExpired() int {
 	if count > 0 {
 		log.Debug().
 			Int("count", count).
-			Int("remaining", len(c.items)).
 			Msg("清理过期缓存项")
 	}
 	return count
@@ -233,17 +552,7 @@ func (c *SearchCache) CleanExpired() int {
 
 // Clear 清空指定类型的缓存
 func (c *SearchCache) Clear(cacheType CacheType) int {
-	c.Lock()
-	defer c.Unlock()
-
-	prefix := string(cacheType) + "|"
-	count := 0
-	for key := range c.items {
-		if len(key) >= len(prefix) && key[:len(prefix)] == prefix {
-			delete(c.items, key)
-			count++
-		}
-	}
+	count := c.store.DeletePrefix(string(cacheType) + "|")
 
 	log.Info().
 		Str("type", string(cacheType)).
@@ -252,13 +561,21 @@ func (c *SearchCache) Clear(cacheType CacheType) int {
 	return count
 }
 
+// Delete 删除单个缓存 Key
+func (c *SearchCache) Delete(key string) bool {
+	if !c.store.Delete(key) {
+		return false
+	}
+
+	log.Info().
+		Str("key", key).
+		Msg("删除缓存 Key")
+	return true
+}
+
 // ClearAll 清空所有缓存
 func (c *SearchCache) ClearAll() {
-	c.Lock()
-	defer c.Unlock()
-
-	count := len(c.items)
-	c.items = make(map[string]cacheItem)
+	count := c.store.DeletePrefix("")
 
 	log.Info().
 		Int("count", count).
@@ -267,22 +584,25 @@ func (c *SearchCache) ClearAll() {
 
 // Size 返回缓存项数量
 func (c *SearchCache) Size() int {
-	c.RLock()
-	defer c.RUnlock()
-	return len(c.items)
+	return c.store.Len()
+}
+
+// Close 取消进行中的上游请求并关闭存储后端
+func (c *SearchCache) Close() error {
+	c.flight.close()
+	return c.store.Close()
 }
 
 // Stats 获取缓存统计信息
 func (c *SearchCache) Stats() map[string]interface{} {
-	c.RLock()
-	defer c.RUnlock()
-
 	now := time.Now()
+	total := 0
 	expired := 0
 	byType := make(map[CacheType]int)
 
-	for key, item := range c.items {
-		if now.After(item.expiresAt) {
+	c.store.Scan(func(key string, expiresAt time.Time) {
+		total++
+		if now.After(expiresAt) {
 			expired++
 		}
 
@@ -297,36 +617,84 @@ func (c *SearchCache) Stats() map[string]interface{} {
 				}
 			}
 		}
-	}
+	})
+
+	c.RLock()
+	defer c.RUnlock()
 
-	return map[string]interface{}{
-		"total_items":   len(c.items),
+	stats := map[string]interface{}{
+		"backend":       c.backend,
+		"total_items":   total,
 		"expired_items": expired,
-		"valid_items":   len(c.items) - expired,
+		"valid_items":   total - expired,
 		"by_type":       byType,
 		"ttl_config": map[string]interface{}{
 			"search": c.ttl[CacheTypeSearch].String(),
 			"id":     c.ttl[CacheTypeID].String(),
 			"hot":    c.ttl[CacheTypeHot].String(),
 		},
+		"stale_config": map[string]interface{}{
+			"search": c.stale[CacheTypeSearch].String(),
+			"id":     c.stale[CacheTypeID].String(),
+			"hot":    c.stale[CacheTypeHot].String(),
+		},
+		"negative_ttl": c.negative.String(),
 	}
+	// 内存后端额外提供占用和淘汰统计
+	if l, ok := c.store.(limiter); ok {
+		for k, v := range l.Stats() {
+			stats[k] = v
+		}
+	}
+	return stats
 }
 
 // DumpKeys 导出所有缓存 Key（用于调试）
 func (c *SearchCache) DumpKeys() []string {
-	c.RLock()
-	defer c.RUnlock()
-
-	keys := make([]string, 0, len(c.items))
+	keys := make([]string, 0)
 	now := time.Now()
 
-	for key, item := range c.items {
+	c.store.Scan(func(key string, expiresAt time.Time) {
 		status := "valid"
-		if now.After(item.expiresAt) {
+		if now.After(expiresAt) {
 			status = "expired"
 		}
-		keys = append(keys, fmt.Sprintf("%s [%s, expires: %s]", key, status, item.expiresAt.Format("15:04:05")))
-	}
+		keys = append(keys, fmt.Sprintf("%s [%s, expires: %s]", key, status, expiresAt.Format("15:04:05")))
+	})
 
 	return keys
 }
+
+// 缓存 Key 信息
+type KeyInfo struct {
+	Key       string    `json:"key"`
+	Type      CacheType `json:"type"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Expired   bool      `json:"expired"`
+}
+
+// Keys 按类型和关键字筛选缓存 Key（cacheType 为空时不限类型，query 为子串匹配），按 Key 排序
+func (c *SearchCache) Keys(cacheType CacheType, query string) []KeyInfo {
+	now := time.Now()
+	keys := make([]KeyInfo, 0)
+	c.store.Scan(func(key string, expiresAt time.Time) {
+		t, _, _ := strings.Cut(key, "|")
+		if cacheType != "" && CacheType(t) != cacheType {
+			return
+		}
+		if query != "" && !strings.Contains(key, query) {
+			return
+		}
+		keys = append(keys, KeyInfo{
+			Key:       key,
+			Type:      CacheType(t),
+			ExpiresAt: expiresAt,
+			Expired:   now.After(expiresAt),
+		})
+	})
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tv/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 所有类型使用相同的缓存时间和旧数据保留时间
+func newTestCache(ttl, stale, negative time.Duration) *SearchCache {
+	all := func(d time.Duration) map[CacheType]time.Duration {
+		return map[CacheType]time.Duration{CacheTypeSearch: d, CacheTypeID: d, CacheTypeHot: d}
+	}
+	return &SearchCache{
+		store:    newMemoryCache(Limits{}),
+		backend:  "memory",
+		ttl:      all(ttl),
+		stale:    all(stale),
+		negative: negative,
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func isStale(resp models.APIResponse) bool {
+	extra, _ := resp.Extra.(gin.H)
+	return extra["stale"] == true
+}
+
+type clientError struct{ msg string }
+
+func (e clientError) Error() string         { return e.msg + ": dial tcp 10.0.0.1:80" }
+func (e clientError) ClientMessage() string { return e.msg }
+
+func TestFetchRevalidatesOnceAfterSoftTTL(t *testing.T) {
+	c := newTestCache(30*time.Millisecond, time.Minute, 0)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (models.APIResponse, error) {
+		n := calls.Add(1)
+		if n > 1 {
+			<-release
+		}
+		return models.APIResponse{Data: int(n)}, nil
+	}
+
+	resp, err := c.fetch(context.Background(), "hot|k", CacheTypeHot, fn)
+	if err != nil || resp.Data != 1 {
+		t.Fatalf("first fetch = %+v, %v", resp, err)
+	}
+	if resp, _ := c.fetch(context.Background(), "hot|k", CacheTypeHot, fn); resp.Data != 1 || isStale(resp) || calls.Load() != 1 {
+		t.Fatalf("fresh fetch = %+v, calls = %d", resp, calls.Load())
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	// 软过期后立即返回旧数据，后台刷新进行中时不再发起新的刷新
+	for range 5 {
+		resp, err := c.fetch(context.Background(), "hot|k", CacheTypeHot, fn)
+		if err != nil || resp.Data != 1 || !isStale(resp) {
+			t.Fatalf("stale fetch = %+v, %v", resp, err)
+		}
+	}
+	waitFor(t, "background refresh", func() bool { return calls.Load() == 2 })
+	close(release)
+
+	waitFor(t, "refreshed value", func() bool {
+		resp, _ := c.fetch(context.Background(), "hot|k", CacheTypeHot, fn)
+		return resp.Data == 2 && !isStale(resp)
+	})
+	if calls.Load() != 2 {
+		t.Errorf("fn called %d times, want 2", calls.Load())
+	}
+}
+
+func TestFetchServesStaleUntilHardTTL(t *testing.T) {
+	c := newTestCache(30*time.Millisecond, 100*time.Millisecond, 0)
+	var fail atomic.Bool
+	var calls atomic.Int32
+	fn := func(ctx context.Context) (models.APIResponse, error) {
+		calls.Add(1)
+		if fail.Load() {
+			return models.APIResponse{}, clientError{"请求视频源失败"}
+		}
+		return models.APIResponse{Data: "v1", Extra: gin.H{"total": 1}}, nil
+	}
+
+	if _, err := c.fetch(context.Background(), "id|a|1", CacheTypeID, fn); err != nil {
+		t.Fatal(err)
+	}
+	item, _ := c.store.Get("id|a|1")
+
+	time.Sleep(40 * time.Millisecond)
+	fail.Store(true)
+	c.fetch(context.Background(), "id|a|1", CacheTypeID, fn)
+	waitFor(t, "failed refresh", func() bool {
+		_, ok := c.refreshErrors.Load("id|a|1")
+		return ok
+	})
+
+	// 刷新失败后继续返回旧数据，并带上软过期时间和刷新错误
+	resp, err := c.fetch(context.Background(), "id|a|1", CacheTypeID, fn)
+	if err != nil || resp.Data != "v1" {
+		t.Fatalf("stale fetch = %+v, %v", resp, err)
+	}
+	extra := resp.Extra.(gin.H)
+	if extra["stale"] != true || extra["total"] != 1 || extra["refresh_error"] != "请求视频源失败" {
+		t.Errorf("extra = %v", extra)
+	}
+	if staleAt, _ := extra["stale_at"].(time.Time); !staleAt.Equal(item.StaleAt) {
+		t.Errorf("stale_at = %v, want %v", extra["stale_at"], item.StaleAt)
+	}
+	// 缓存中的原对象不被修改
+	if cached, _ := c.store.Get("id|a|1"); isStale(cached.Data) {
+		t.Error("cached item marked stale")
+	}
+
+	// 硬过期后返回错误
+	time.Sleep(100 * time.Millisecond)
+	calls.Store(0)
+	if _, err := c.fetch(context.Background(), "id|a|1", CacheTypeID, fn); err == nil {
+		t.Error("fetch after hard TTL returned stale data")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("fn called %d times after hard TTL, want 1", calls.Load())
+	}
+}
+
+func TestClientMessage(t *testing.T) {
+	if got := clientMessage(clientError{"请求视频源失败"}); got != "请求视频源失败" {
+		t.Errorf("clientMessage = %q", got)
+	}
+	if got := clientMessage(errors.New("open /srv/ytv/cache.db: permission denied")); got != "后台刷新失败" {
+		t.Errorf("clientMessage = %q", got)
+	}
+}
+
+func TestFetchSearchCachesPerSource(t *testing.T) {
+	c := newTestCache(time.Minute, 0, 50*time.Millisecond)
+	var okCalls, failCalls atomic.Int32
+	ok := func(ctx context.Context) ([]models.VodItem, error) {
+		okCalls.Add(1)
+		return []models.VodItem{{SourceKey: "a", VodID: 1}}, nil
+	}
+	fail := func(ctx context.Context) ([]models.VodItem, error) {
+		failCalls.Add(1)
+		return nil, errors.New("请求失败")
+	}
+	a := SearchParams{SourceKey: "a", Keyword: "k", Page: "1"}
+	b := SearchParams{SourceKey: "b", Keyword: "k", Page: "1"}
+
+	for range 2 {
+		if entry := c.FetchSearch(context.Background(), a, ok); entry.Error != "" || len(entry.Items) != 1 {
+			t.Fatalf("a = %+v", entry)
+		}
+		if entry := c.FetchSearch(context.Background(), b, fail); entry.Error != "请求失败" {
+			t.Fatalf("b = %+v", entry)
+		}
+	}
+	// 成功结果和失败结果都命中缓存
+	if okCalls.Load() != 1 || failCalls.Load() != 1 {
+		t.Fatalf("calls = %d, %d, want 1, 1", okCalls.Load(), failCalls.Load())
+	}
+
+	// 失败结果只缓存 cache.negative，之后重新请求失败的源，成功的源仍命中缓存
+	time.Sleep(60 * time.Millisecond)
+	c.FetchSearch(context.Background(), a, ok)
+	c.FetchSearch(context.Background(), b, fail)
+	if okCalls.Load() != 1 || failCalls.Load() != 2 {
+		t.Errorf("calls after negative TTL = %d, %d, want 1, 2", okCalls.Load(), failCalls.Load())
+	}
+
+	// 失败结果的缓存不保留旧数据
+	item, _ := c.store.Get(b.key())
+	if !item.ExpiresAt.Equal(item.StaleAt) {
+		t.Errorf("negative entry kept for %s after stale", item.ExpiresAt.Sub(item.StaleAt))
+	}
+}
+
+func TestFetchSearchNegativeDisabled(t *testing.T) {
+	c := newTestCache(time.Minute, 0, 0)
+	var calls atomic.Int32
+	fail := func(ctx context.Context) ([]models.VodItem, error) {
+		calls.Add(1)
+		return nil, errors.New("请求失败")
+	}
+	params := SearchParams{SourceKey: "b", Keyword: "k", Page: "1"}
+	c.FetchSearch(context.Background(), params, fail)
+	c.FetchSearch(context.Background(), params, fail)
+	if calls.Load() != 2 {
+		t.Errorf("fn called %d times, want 2", calls.Load())
+	}
+}
+
+func TestFetchSearchCancelledNotCached(t *testing.T) {
+	c := newTestCache(time.Minute, 0, time.Minute)
+	params := SearchParams{SourceKey: "a", Keyword: "k", Page: "1"}
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	slow := func(ctx context.Context) ([]models.VodItem, error) {
+		defer close(finished)
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if entry := c.FetchSearch(ctx, params, slow); entry.Error == "" {
+		t.Fatalf("entry = %+v, want error", entry)
+	}
+	<-finished
+	waitFor(t, "flight to finish", func() bool {
+		c.flight.mu.Lock()
+		defer c.flight.mu.Unlock()
+		return len(c.flight.calls) == 0
+	})
+
+	if _, ok := c.store.Get(params.key()); ok {
+		t.Fatal("cancelled request was negative-cached")
+	}
+	entry := c.FetchSearch(context.Background(), params, func(ctx context.Context) ([]models.VodItem, error) {
+		return []models.VodItem{{VodID: 1}}, nil
+	})
+	if entry.Error != "" || len(entry.Items) != 1 {
+		t.Errorf("entry after cancel = %+v", entry)
+	}
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+var diskBucket = []byte("cache")
+
+// diskCache 基于 bbolt 的本地文件缓存，重启后保留
+// 值的格式：8 字节过期时间（UnixNano，大端序）+ JSON 响应
+type diskCache struct {
+	db *bolt.DB
+}
+
+func newDiskCache(path string) (*diskCache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(diskBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.Info().Str("path", path).Msg("磁盘缓存已打开")
+	return &diskCache{db: db}, nil
+}
+
+func (d *diskCache) Get(key string) (Item, bool) {
+	var raw []byte
+	d.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(diskBucket).Get([]byte(key)); v != nil {
+			raw = append([]byte(nil), v...) // 事务结束后 v 不再有效
+		}
+		return nil
+	})
+	if len(raw) < 8 {
+		return Item{}, false
+	}
+
+	item, err := decodeItem(key, raw[8:])
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("磁盘缓存条目解析失败")
+		return Item{}, false
+	}
+	item.ExpiresAt = decodeExpiry(raw)
+	return item, true
+}
+
+func (d *diskCache) Set(key string, item Item) error {
+	body, err := encodeItem(item)
+	if err != nil {
+		return err
+	}
+	value := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint64(value, uint64(item.ExpiresAt.UnixNano()))
+	value = append(value, body...)
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(diskBucket).Put([]byte(key), value)
+	})
+}
+
+func (d *diskCache) Delete(key string) bool {
+	deleted := false
+	d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diskBucket)
+		if b.Get([]byte(key)) == nil {
+			return nil
+		}
+		deleted = true
+		return b.Delete([]byte(key))
+	})
+	return deleted
+}
+
+func (d *diskCache) DeletePrefix(prefix string) int {
+	count := 0
+	d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diskBucket)
+		p := []byte(prefix)
+		c := b.Cursor()
+		for k, _ := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = c.Seek(p) {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+func (d *diskCache) Scan(fn func(key string, expiresAt time.Time)) {
+	d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(diskBucket).ForEach(func(k, v []byte) error {
+			fn(string(k), decodeExpiry(v))
+			return nil
+		})
+	})
+}
+
+func (d *diskCache) Len() int {
+	n := 0
+	d.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(diskBucket).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+func (d *diskCache) Close() error {
+	return d.db.Close()
+}
+
+func decodeExpiry(v []byte) time.Time {
+	if len(v) < 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(v[:8])))
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"tv/metrics"
+	"tv/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// flightGroup 合并相同 Key 的并发请求：同一时刻只有第一个请求访问上游，其余请求等待并共享结果
+//
+// 上游请求在独立的协程中执行，使用的 Context 不随发起请求的客户端断开而取消：
+// 只要还有请求在等待结果就继续执行并写入缓存，所有等待的请求都离开后才取消。
+// close 取消全部进行中的上游请求，用于服务退出。
+type flightGroup struct {
+	mu     sync.Mutex
+	calls  map[string]*flightCall
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type flightCall struct {
+	done    chan struct{}
+	resp    models.APIResponse
+	err     error
+	waiters int                // 合并进来的请求数
+	refs    int                // 仍在等待结果的请求数（包括发起者）
+	cancel  context.CancelFunc // 取消上游请求
+}
+
+// do 执行 fn 或等待正在执行的相同请求，shared 表示结果来自其他请求
+// ctx 取消时立即返回 ctx.Err()，fn 继续为其他等待的请求执行
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (models.APIResponse, error)) (resp models.APIResponse, err error, shared bool) {
+	g.mu.Lock()
+	g.init()
+	if call, ok := g.calls[key]; ok {
+		call.waiters++
+		call.refs++
+		g.mu.Unlock()
+		return g.wait(ctx, call, true)
+	}
+
+	// 保留 ctx 中的 Span 等数据，但不继承它的取消
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(g.ctx, cancel)
+	call := &flightCall{done: make(chan struct{}), refs: 1, cancel: cancel}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	go func() {
+		start := time.Now()
+		defer func() {
+			// 协程中的 panic 无法交给 Recovery 中间件，记录日志后作为错误返回给等待的请求
+			if r := recover(); r != nil {
+				call.err = fmt.Errorf("请求异常: %v", r)
+				log.Error().Str("key", key).Interface("panic", r).Msg("上游请求异常")
+			}
+
+			g.mu.Lock()
+			delete(g.calls, key)
+			waiters := call.waiters
+			g.mu.Unlock()
+			close(call.done)
+			stop()
+			cancel()
+
+			if waiters > 0 {
+				metrics.CacheCoalesced(keyType(key), waiters)
+				log.Info().
+					Str("key", key).
+					Int("waiters", waiters).
+					Dur("duration", time.Since(start)).
+					Msg("合并相同的并发请求")
+			}
+		}()
+
+		call.resp, call.err = fn(callCtx)
+	}()
+
+	return g.wait(ctx, call, false)
+}
+
+// 等待结果，ctx 取消时离开；最后一个等待的请求离开时取消上游请求
+func (g *flightGroup) wait(ctx context.Context, call *flightCall, shared bool) (models.APIResponse, error, bool) {
+	select {
+	case <-call.done:
+		return call.resp, call.err, shared
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.refs--
+		if call.refs == 0 {
+			call.cancel()
+		}
+		g.mu.Unlock()
+		return models.APIResponse{}, ctx.Err(), shared
+	}
+}
+
+// goDo 在后台执行 fn，相同 Key 已有请求在执行时不再重复发起
+func (g *flightGroup) goDo(ctx context.Context, key string, fn func(context.Context) (models.APIResponse, error)) {
+	g.mu.Lock()
+	_, busy := g.calls[key]
+	g.mu.Unlock()
+	if busy {
+		return
+	}
+
+	go g.do(context.WithoutCancel(ctx), key, fn)
+}
+
+// close 取消所有进行中的上游请求
+func (g *flightGroup) close() {
+	g.mu.Lock()
+	g.init()
+	g.mu.Unlock()
+	g.cancel()
+}
+
+// 需持有 mu
+func (g *flightGroup) init() {
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+		g.ctx, g.cancel = context.WithCancel(context.Background())
+	}
+}
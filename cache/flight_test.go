@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tv/models"
+)
+
+// 等待 key 上的请求数达到 refs
+func waitRefs(t *testing.T, g *flightGroup, key string, refs int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		g.mu.Lock()
+		call, ok := g.calls[key]
+		n := 0
+		if ok {
+			n = call.refs
+		}
+		g.mu.Unlock()
+		if n == refs {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("refs of %s did not reach %d", key, refs)
+}
+
+type flightResult struct {
+	resp   models.APIResponse
+	err    error
+	shared bool
+}
+
+func goFlight(g *flightGroup, ctx context.Context, key string, fn func(context.Context) (models.APIResponse, error)) <-chan flightResult {
+	ch := make(chan flightResult, 1)
+	go func() {
+		resp, err, shared := g.do(ctx, key, fn)
+		ch <- flightResult{resp, err, shared}
+	}()
+	return ch
+}
+
+func TestFlightCoalesces(t *testing.T) {
+	var g flightGroup
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (models.APIResponse, error) {
+		calls.Add(1)
+		<-release
+		return models.APIResponse{Data: "ok"}, nil
+	}
+
+	first := goFlight(&g, context.Background(), "search|k", fn)
+	waitRefs(t, &g, "search|k", 1)
+	second := goFlight(&g, context.Background(), "search|k", fn)
+	waitRefs(t, &g, "search|k", 2)
+	close(release)
+
+	r1, r2 := <-first, <-second
+	if calls.Load() != 1 {
+		t.Errorf("fn called %d times, want 1", calls.Load())
+	}
+	if r1.err != nil || r2.err != nil || r1.resp.Data != "ok" || r2.resp.Data != "ok" {
+		t.Errorf("results = %+v, %+v", r1, r2)
+	}
+	if r1.shared || !r2.shared {
+		t.Errorf("shared = %v, %v, want false, true", r1.shared, r2.shared)
+	}
+}
+
+func TestFlightWaiterLeavesWithoutCancellingOthers(t *testing.T) {
+	var g flightGroup
+	release := make(chan struct{})
+	var cancelled atomic.Bool
+	fn := func(ctx context.Context) (models.APIResponse, error) {
+		select {
+		case <-release:
+			return models.APIResponse{Data: "ok"}, nil
+		case <-ctx.Done():
+			cancelled.Store(true)
+			return models.APIResponse{}, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := goFlight(&g, ctx, "id|k", fn)
+	waitRefs(t, &g, "id|k", 1)
+	second := goFlight(&g, context.Background(), "id|k", fn)
+	waitRefs(t, &g, "id|k", 2)
+
+	// 发起请求的客户端断开，立即返回，上游请求继续为另一个请求执行
+	cancel()
+	if r := <-first; !errors.Is(r.err, context.Canceled) {
+		t.Fatalf("first err = %v, want context.Canceled", r.err)
+	}
+	close(release)
+	if r := <-second; r.err != nil || r.resp.Data != "ok" {
+		t.Errorf("second = %+v, want ok", r)
+	}
+	if cancelled.Load() {
+		t.Error("upstream request cancelled while a waiter remained")
+	}
+}
+
+func TestFlightLastWaiterCancelsUpstream(t *testing.T) {
+	var g flightGroup
+	done := make(chan error, 1)
+	fn := func(ctx context.Context) (models.APIResponse, error) {
+		<-ctx.Done()
+		done <- ctx.Err()
+		return models.APIResponse{}, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	first := goFlight(&g, ctx1, "search|k", fn)
+	waitRefs(t, &g, "search|k", 1)
+	second := goFlight(&g, ctx2, "search|k", fn)
+	waitRefs(t, &g, "search|k", 2)
+
+	cancel1()
+	<-first
+	select {
+	case <-done:
+		t.Fatal("upstream request cancelled before the last waiter left")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel2()
+	<-second
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("upstream ctx err = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("upstream request not cancelled after all waiters left")
+	}
+}
+
+func TestFlightClose(t *testing.T) {
+	var g flightGroup
+	fn := func(ctx context.Context) (models.APIResponse, error) {
+		<-ctx.Done()
+		return models.APIResponse{}, ctx.Err()
+	}
+
+	result := goFlight(&g, context.Background(), "hot|k", fn)
+	waitRefs(t, &g, "hot|k", 1)
+	g.close()
+
+	select {
+	case r := <-result:
+		if !errors.Is(r.err, context.Canceled) {
+			t.Errorf("err = %v, want context.Canceled", r.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("close did not cancel the in-flight request")
+	}
+}
+
+func TestFlightPanic(t *testing.T) {
+	var g flightGroup
+	_, err, _ := g.do(context.Background(), "id|k", func(context.Context) (models.APIResponse, error) {
+		panic("boom")
+	})
+	if err == nil {
+		t.Fatal("panic not returned as error")
+	}
+
+	// panic 后同一 Key 可以再次执行
+	resp, err, _ := g.do(context.Background(), "id|k", func(context.Context) (models.APIResponse, error) {
+		return models.APIResponse{Data: "ok"}, nil
+	})
+	if err != nil || resp.Data != "ok" {
+		t.Errorf("resp = %+v, err = %v", resp, err)
+	}
+}
+
+func TestFlightGoDoSkipsBusyKey(t *testing.T) {
+	var g flightGroup
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (models.APIResponse, error) {
+		calls.Add(1)
+		<-release
+		return models.APIResponse{}, nil
+	}
+
+	result := goFlight(&g, context.Background(), "hot|k", fn)
+	waitRefs(t, &g, "hot|k", 1)
+	g.goDo(context.Background(), "hot|k", fn)
+	waitRefs(t, &g, "hot|k", 1)
+	close(release)
+	<-result
+
+	if calls.Load() != 1 {
+		t.Errorf("fn called %d times, want 1", calls.Load())
+	}
+}
@@ -0,0 +1,267 @@
+package cache
+
+import (
+	"container/list"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+	"tv/metrics"
+
+	"github.com/rs/zerolog/log"
+)
+
+// 每个条目除数据外的估算开销（map、链表节点、Item 结构）
+const entryOverhead = 128
+
+// 内存缓存的容量限制
+type Limits struct {
+	MaxEntries int            // 总条目数上限，0 表示不限
+	MaxBytes   int64          // 估算内存上限，0 表示不限
+	Quotas     map[string]int // 各类型占上限的百分比，未配置的类型只受总上限约束
+}
+
+// memoryCache 进程内缓存，直接保存响应对象，重启后丢失
+// 超出上限时按 LRU 淘汰：先淘汰超出配额的类型，再淘汰全局最久未访问的条目
+type memoryCache struct {
+	sync.Mutex
+	items  map[string]*list.Element
+	lists  map[string]*list.List // 每种类型一条 LRU 链表，表头为最近访问
+	limits Limits
+
+	bytes     int64
+	byType    map[string]*typeUsage
+	evictions map[string]int64
+}
+
+type memoryEntry struct {
+	key        string
+	typ        string
+	item       Item
+	size       int64
+	lastAccess time.Time
+}
+
+type typeUsage struct {
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+}
+
+func newMemoryCache(limits Limits) *memoryCache {
+	return &memoryCache{
+		items:     make(map[string]*list.Element),
+		lists:     make(map[string]*list.List),
+		limits:    limits,
+		byType:    make(map[string]*typeUsage),
+		evictions: make(map[string]int64),
+	}
+}
+
+func (m *memoryCache) Get(key string) (Item, bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return Item{}, false
+	}
+	entry := el.Value.(*memoryEntry)
+	entry.lastAccess = time.Now()
+	m.lists[entry.typ].MoveToFront(el)
+	return entry.item, true
+}
+
+func (m *memoryCache) Set(key string, item Item) error {
+	size := estimateSize(key, item)
+
+	m.Lock()
+	defer m.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.remove(el)
+	}
+
+	typ := keyType(key)
+	l, ok := m.lists[typ]
+	if !ok {
+		l = list.New()
+		m.lists[typ] = l
+	}
+	entry := &memoryEntry{key: key, typ: typ, item: item, size: size, lastAccess: time.Now()}
+	m.items[key] = l.PushFront(entry)
+	m.account(typ, 1, size)
+
+	m.evict(typ)
+	return nil
+}
+
+func (m *memoryCache) Delete(key string) bool {
+	m.Lock()
+	defer m.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return false
+	}
+	m.remove(el)
+	return true
+}
+
+func (m *memoryCache) DeletePrefix(prefix string) int {
+	m.Lock()
+	defer m.Unlock()
+
+	count := 0
+	for key, el := range m.items {
+		if strings.HasPrefix(key, prefix) {
+			m.remove(el)
+			count++
+		}
+	}
+	return count
+}
+
+func (m *memoryCache) Scan(fn func(key string, expiresAt time.Time)) {
+	m.Lock()
+	defer m.Unlock()
+	for key, el := range m.items {
+		fn(key, el.Value.(*memoryEntry).item.ExpiresAt)
+	}
+}
+
+func (m *memoryCache) Len() int {
+	m.Lock()
+	defer m.Unlock()
+	return len(m.items)
+}
+
+func (m *memoryCache) Close() error {
+	return nil
+}
+
+// SetLimits 修改容量限制，超出部分立即淘汰
+func (m *memoryCache) SetLimits(limits Limits) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.limits = limits
+	for typ := range m.lists {
+		m.evict(typ)
+	}
+}
+
+// Stats 内存占用和淘汰统计
+func (m *memoryCache) Stats() map[string]any {
+	m.Lock()
+	defer m.Unlock()
+
+	usage := make(map[string]typeUsage, len(m.byType))
+	for typ, u := range m.byType {
+		usage[typ] = *u
+	}
+	evictions := make(map[string]int64, len(m.evictions))
+	var total int64
+	for typ, n := range m.evictions {
+		evictions[typ] = n
+		total += n
+	}
+
+	return map[string]any{
+		"bytes":             m.bytes,
+		"max_bytes":         m.limits.MaxBytes,
+		"max_entries":       m.limits.MaxEntries,
+		"quotas":            m.limits.Quotas,
+		"usage_by_type":     usage,
+		"evictions":         total,
+		"evictions_by_type": evictions,
+	}
+}
+
+// ============ LRU ============
+
+// 淘汰条目直到满足限制（调用方需持有锁）
+// 刚写入的条目所属类型先按配额淘汰，再按总上限淘汰全局最久未访问的条目
+func (m *memoryCache) evict(typ string) {
+	if quota := m.limits.Quotas[typ]; quota > 0 {
+		maxEntries := m.limits.MaxEntries * quota / 100
+		maxBytes := m.limits.MaxBytes * int64(quota) / 100
+		for m.overLimit(m.byType[typ], maxEntries, maxBytes) {
+			m.evictOldest(m.lists[typ])
+		}
+	}
+
+	for m.overLimit(&typeUsage{Entries: len(m.items), Bytes: m.bytes}, m.limits.MaxEntries, m.limits.MaxBytes) {
+		var oldest *list.List
+		var oldestAt time.Time
+		for _, l := range m.lists {
+			back := l.Back()
+			if back == nil {
+				continue
+			}
+			if at := back.Value.(*memoryEntry).lastAccess; oldest == nil || at.Before(oldestAt) {
+				oldest, oldestAt = l, at
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		m.evictOldest(oldest)
+	}
+}
+
+// 是否超出限制；只剩一个条目时不再淘汰，避免单个超大条目被反复写入又淘汰
+func (m *memoryCache) overLimit(u *typeUsage, maxEntries int, maxBytes int64) bool {
+	if u == nil || u.Entries <= 1 {
+		return false
+	}
+	return (maxEntries > 0 && u.Entries > maxEntries) || (maxBytes > 0 && u.Bytes > maxBytes)
+}
+
+func (m *memoryCache) evictOldest(l *list.List) {
+	el := l.Back()
+	if el == nil {
+		return
+	}
+	entry := el.Value.(*memoryEntry)
+	m.remove(el)
+	m.evictions[entry.typ]++
+	metrics.CacheEvicted(entry.typ)
+
+	log.Debug().
+		Str("key", entry.key).
+		Int64("size", entry.size).
+		Msg("缓存已满，淘汰最久未访问的条目")
+}
+
+func (m *memoryCache) remove(el *list.Element) {
+	entry := el.Value.(*memoryEntry)
+	m.lists[entry.typ].Remove(el)
+	delete(m.items, entry.key)
+	m.account(entry.typ, -1, -entry.size)
+}
+
+func (m *memoryCache) account(typ string, entries int, bytes int64) {
+	u, ok := m.byType[typ]
+	if !ok {
+		u = &typeUsage{}
+		m.byType[typ] = u
+	}
+	u.Entries += entries
+	u.Bytes += bytes
+	m.bytes += bytes
+}
+
+// 按 JSON 序列化后的长度估算条目占用的内存
+func estimateSize(key string, item Item) int64 {
+	size := int64(len(key) + entryOverhead)
+	if b, err := json.Marshal(item.Data); err == nil {
+		size += int64(len(b))
+	}
+	return size
+}
+
+// Key 的类型前缀
+func keyType(key string) string {
+	t, _, _ := strings.Cut(key, "|")
+	return t
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"tv/models"
+)
+
+func testItem(data string) Item {
+	return Item{Data: models.APIResponse{Data: data}, ExpiresAt: time.Now().Add(time.Hour)}
+}
+
+func keysOf(m *memoryCache) map[string]bool {
+	keys := make(map[string]bool)
+	m.Scan(func(key string, _ time.Time) { keys[key] = true })
+	return keys
+}
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	m := newMemoryCache(Limits{MaxEntries: 3})
+	for _, key := range []string{"search|a", "search|b", "search|c"} {
+		m.Set(key, testItem(key))
+	}
+	// 访问 a 后 b 成为最久未访问的条目
+	if _, ok := m.Get("search|a"); !ok {
+		t.Fatal("search|a missing")
+	}
+	m.Set("search|d", testItem("d"))
+
+	keys := keysOf(m)
+	if len(keys) != 3 || keys["search|b"] || !keys["search|a"] || !keys["search|d"] {
+		t.Errorf("keys = %v, want a, c, d", keys)
+	}
+	if got := m.Stats()["evictions"]; got != int64(1) {
+		t.Errorf("evictions = %v, want 1", got)
+	}
+}
+
+func TestMemoryQuota(t *testing.T) {
+	m := newMemoryCache(Limits{MaxEntries: 10, Quotas: map[string]int{"search": 50}})
+	for i := 0; i < 3; i++ {
+		m.Set(fmt.Sprintf("hot|%d", i), testItem("hot"))
+	}
+	for i := 0; i < 7; i++ {
+		m.Set(fmt.Sprintf("search|%d", i), testItem("search"))
+	}
+
+	// search 最多占 50%，超出时只淘汰 search 中最早的条目
+	usage := m.Stats()["usage_by_type"].(map[string]typeUsage)
+	if usage["search"].Entries != 5 || usage["hot"].Entries != 3 {
+		t.Fatalf("usage = %+v, want search=5 hot=3", usage)
+	}
+	keys := keysOf(m)
+	if keys["search|0"] || keys["search|1"] || !keys["search|6"] {
+		t.Errorf("keys = %v, want search|0 and search|1 evicted", keys)
+	}
+	if got := m.Stats()["evictions_by_type"].(map[string]int64); got["search"] != 2 || got["hot"] != 0 {
+		t.Errorf("evictions_by_type = %v", got)
+	}
+}
+
+func TestMemoryGlobalLimitEvictsOldestAcrossTypes(t *testing.T) {
+	m := newMemoryCache(Limits{MaxEntries: 2})
+	m.Set("hot|1", testItem("hot"))
+	time.Sleep(time.Millisecond)
+	m.Set("search|1", testItem("search"))
+	time.Sleep(time.Millisecond)
+	m.Get("hot|1")
+	time.Sleep(time.Millisecond)
+	m.Set("id|1", testItem("id"))
+
+	keys := keysOf(m)
+	if len(keys) != 2 || keys["search|1"] {
+		t.Errorf("keys = %v, want search|1 evicted", keys)
+	}
+}
+
+func TestMemoryMaxBytes(t *testing.T) {
+	size := estimateSize("search|0", testItem("data"))
+	m := newMemoryCache(Limits{MaxBytes: size * 2})
+	for i := 0; i < 3; i++ {
+		m.Set(fmt.Sprintf("search|%d", i), testItem("data"))
+	}
+	if m.Len() != 2 || m.Stats()["bytes"].(int64) > size*2 {
+		t.Errorf("len = %d bytes = %v, want 2 entries within %d bytes", m.Len(), m.Stats()["bytes"], size*2)
+	}
+
+	// 单个条目超过上限时仍然保留
+	m.SetLimits(Limits{MaxBytes: 1})
+	if m.Len() != 1 {
+		t.Errorf("len = %d, want 1", m.Len())
+	}
+}
+
+func TestMemoryOverwriteAndDelete(t *testing.T) {
+	m := newMemoryCache(Limits{MaxEntries: 2})
+	m.Set("search|a", testItem("short"))
+	m.Set("search|a", testItem("a much longer value than before"))
+	m.Set("search|b", testItem("b"))
+
+	if m.Len() != 2 {
+		t.Fatalf("len = %d, want 2", m.Len())
+	}
+	want := estimateSize("search|a", testItem("a much longer value than before")) + estimateSize("search|b", testItem("b"))
+	if got := m.Stats()["bytes"].(int64); got != want {
+		t.Errorf("bytes = %d, want %d", got, want)
+	}
+
+	if !m.Delete("search|a") || m.Delete("search|a") {
+		t.Error("Delete should succeed once")
+	}
+	if n := m.DeletePrefix("search|"); n != 1 || m.Len() != 0 || m.Stats()["bytes"].(int64) != 0 {
+		t.Errorf("DeletePrefix = %d, len = %d, bytes = %v", n, m.Len(), m.Stats()["bytes"])
+	}
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const redisTimeout = 2 * time.Second
+
+// redisCache 使用 Redis 协议的外部缓存，可在多个实例间共享
+// Key 统一加前缀，过期时间交给 Redis 处理
+type redisCache struct {
+	client *redis.Client
+	prefix string
+}
+
+func newRedisCache(url, prefix string) (*redisCache, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	log.Info().Str("addr", opts.Addr).Int("db", opts.DB).Str("prefix", prefix).Msg("Redis 缓存已连接")
+	return &redisCache{client: client, prefix: prefix}, nil
+}
+
+func (r *redisCache) Get(key string) (Item, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	pipe := r.client.Pipeline()
+	getCmd := pipe.Get(ctx, r.prefix+key)
+	ttlCmd := pipe.PTTL(ctx, r.prefix+key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Warn().Err(err).Str("key", key).Msg("读取 Redis 缓存失败")
+		}
+		return Item{}, false
+	}
+
+	item, err := decodeItem(key, []byte(getCmd.Val()))
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Redis 缓存条目解析失败")
+		return Item{}, false
+	}
+	item.ExpiresAt = time.Now().Add(ttlCmd.Val())
+	return item, true
+}
+
+func (r *redisCache) Set(key string, item Item) error {
+	ttl := time.Until(item.ExpiresAt)
+	if ttl <= 0 {
+		r.Delete(key)
+		return nil
+	}
+	body, err := encodeItem(item)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return r.client.Set(ctx, r.prefix+key, body, ttl).Err()
+}
+
+func (r *redisCache) Delete(key string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	n, err := r.client.Del(ctx, r.prefix+key).Result()
+	return err == nil && n > 0
+}
+
+func (r *redisCache) DeletePrefix(prefix string) int {
+	keys := r.scanKeys(prefix)
+	if len(keys) == 0 {
+		return 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	count := 0
+	for start := 0; start < len(keys); start += 500 {
+		end := min(start+500, len(keys))
+		n, err := r.client.Del(ctx, keys[start:end]...).Result()
+		if err != nil {
+			log.Warn().Err(err).Msg("删除 Redis 缓存失败")
+			break
+		}
+		count += int(n)
+	}
+	return count
+}
+
+func (r *redisCache) Scan(fn func(key string, expiresAt time.Time)) {
+	keys := r.scanKeys("")
+	if len(keys) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.PTTL(ctx, key)
+	}
+	pipe.Exec(ctx)
+
+	now := time.Now()
+	for i, key := range keys {
+		ttl := cmds[i].Val()
+		if ttl < 0 {
+			// Key 在遍历期间过期
+			continue
+		}
+		fn(key[len(r.prefix):], now.Add(ttl))
+	}
+}
+
+func (r *redisCache) Len() int {
+	return len(r.scanKeys(""))
+}
+
+func (r *redisCache) Close() error {
+	return r.client.Close()
+}
+
+// 列出带前缀的全部 Key（返回值包含 r.prefix）
+func (r *redisCache) scanKeys(prefix string) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	var keys []string
+	iter := r.client.Scan(ctx, 0, escapeGlob(r.prefix+prefix)+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		log.Warn().Err(err).Msg("遍历 Redis 缓存失败")
+	}
+	return keys
+}
+
+// 转义 SCAN MATCH 的通配符，关键词中的 * ? [ ] \ 按字面匹配
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package conf
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const defaultConfigPath = "data/config.yaml"
+
+// 命令行参数
+var flags = newFlagSet()
+
+// 命令行参数与配置项的对应关系
+var flagKeys = map[string]string{
+	"addr":         "server.addr",
+	"base-path":    "server.base_path",
+	"api-prefix":   "server.api_prefix",
+	"spa":          "server.spa_path",
+	"cors-origins": "server.cors_origins",
+	"log-level":    "log.level",
+}
+
+func newFlagSet() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("ytv", pflag.ExitOnError)
+	fs.StringP("config", "c", "", "配置文件路径（默认 "+defaultConfigPath+"）")
+	fs.String("addr", "", "监听地址，如 :9000（默认使用 app.port）")
+	fs.String("base-path", "", "反向代理子路径，如 /tv")
+	fs.String("api-prefix", "", "API 路径前缀（默认 /api/v1）")
+	fs.String("spa", "", "前端静态文件目录")
+	fs.StringSlice("cors-origins", nil, "允许跨域的来源，多个用逗号分隔，* 表示全部")
+	fs.String("log-level", "", "日志级别：trace/debug/info/warn/error")
+	return fs
+}
+
+// ParseFlags 解析命令行参数
+func ParseFlags(args []string) {
+	flags.Parse(args)
+}
+
+// ConfigPath 配置文件路径，优先级：命令行 > YTV_CONFIG > API_CONFIG_PATH > 默认值
+func ConfigPath() string {
+	if path, _ := flags.GetString("config"); path != "" {
+		return path
+	}
+	for _, env := range []string{"YTV_CONFIG", "API_CONFIG_PATH"} {
+		if path := os.Getenv(env); path != "" {
+			return path
+		}
+	}
+	return defaultConfigPath
+}
+
+// 环境变量：YTV_ 前缀，层级用下划线连接，如 YTV_SERVER_ADDR、YTV_CACHE_SEARCH
+// 同时兼容旧的 PORT 和 APP_MODE
+func bindEnv(v *viper.Viper) {
+	v.SetEnvPrefix("YTV")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	v.BindEnv("app.port", "YTV_APP_PORT", "PORT")
+	v.BindEnv("app.mode", "YTV_APP_MODE", "APP_MODE")
+}
+
+// 只有显式传入的命令行参数才会覆盖配置
+func bindFlags(v *viper.Viper) {
+	for name, key := range flagKeys {
+		v.BindPFlag(key, flags.Lookup(name))
+	}
+}
@@ -0,0 +1,120 @@
+package conf
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 解析测试用的命令行参数，测试结束后恢复
+func setFlags(t *testing.T, args ...string) {
+	t.Helper()
+	flags = newFlagSet()
+	t.Cleanup(func() { flags = newFlagSet() })
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigLayering(t *testing.T) {
+	const yaml = "server:\n  api_prefix: /api/yaml\n  spa_path: ./yaml\n" + testSources
+	tests := []struct {
+		name string
+		yaml string
+		env  string
+		args []string
+		want string
+	}{
+		{"default", testSources, "", nil, "/api/v1"},
+		{"yaml over default", yaml, "", nil, "/api/yaml"},
+		{"env over yaml", yaml, "/api/env", nil, "/api/env"},
+		{"flag over env", yaml, "/api/env", []string{"--api-prefix", "/api/flag"}, "/api/flag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, tt.args...)
+			t.Setenv("YTV_SERVER_API_PREFIX", tt.env)
+
+			cfg, _, err := parse([]byte(tt.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.APIPrefix != tt.want {
+				t.Errorf("api_prefix = %q, want %q", cfg.Server.APIPrefix, tt.want)
+			}
+			// 未覆盖的配置项保持各自的来源
+			if tt.yaml == yaml && cfg.Server.SPAPath != "./yaml" {
+				t.Errorf("spa_path = %q, want ./yaml", cfg.Server.SPAPath)
+			}
+		})
+	}
+}
+
+func TestListenAddrLayering(t *testing.T) {
+	const yaml = "app:\n  port: \"9100\"\n" + testSources
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"yaml", nil, nil, ":9100"},
+		{"legacy PORT", map[string]string{"PORT": "9200"}, nil, ":9200"},
+		{"YTV_APP_PORT over PORT", map[string]string{"PORT": "9200", "YTV_APP_PORT": "9300"}, nil, ":9300"},
+		{"addr over port", map[string]string{"YTV_SERVER_ADDR": "127.0.0.1:9400"}, nil, "127.0.0.1:9400"},
+		{"flag over env", map[string]string{"YTV_SERVER_ADDR": "127.0.0.1:9400"}, []string{"--addr", ":9500"}, ":9500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, tt.args...)
+			// 空值视为未设置，避免受运行环境影响
+			for _, k := range []string{"PORT", "YTV_APP_PORT", "YTV_SERVER_ADDR"} {
+				t.Setenv(k, "")
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, _, err := parse([]byte(yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cfg.ListenAddr(); got != tt.want {
+				t.Errorf("ListenAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSOriginsFlag(t *testing.T) {
+	setFlags(t, "--cors-origins", "https://a.example.com,https://b.example.com")
+	cfg, _, err := parse([]byte("server:\n  cors_origins: [\"https://yaml.example.com\"]\n" + testSources))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://a.example.com", "https://b.example.com"}
+	if !reflect.DeepEqual(cfg.Server.CORSOrigins, want) {
+		t.Errorf("cors_origins = %v, want %v", cfg.Server.CORSOrigins, want)
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	t.Setenv("YTV_CONFIG", "")
+	t.Setenv("API_CONFIG_PATH", "")
+	setFlags(t)
+	if got := ConfigPath(); got != defaultConfigPath {
+		t.Errorf("default = %q", got)
+	}
+
+	t.Setenv("API_CONFIG_PATH", "/legacy.yaml")
+	if got := ConfigPath(); got != "/legacy.yaml" {
+		t.Errorf("API_CONFIG_PATH = %q", got)
+	}
+	t.Setenv("YTV_CONFIG", "/env.yaml")
+	if got := ConfigPath(); got != "/env.yaml" {
+		t.Errorf("YTV_CONFIG = %q", got)
+	}
+	setFlags(t, "-c", "/flag.yaml")
+	if got := ConfigPath(); got != "/flag.yaml" {
+		t.Errorf("-c = %q", got)
+	}
+}
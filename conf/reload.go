@@ -0,0 +1,189 @@
+package conf
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// 修改后需要重启才能生效的配置项（前缀匹配）
+var restartKeys = []string{
+	"server.",
+	"app.port",
+	"app.mode",
+	"app.data_dir",
+	"cache.backend.",
+	"metrics.",
+	"tracing.",
+	"users.admin_username",
+	"users.admin_password",
+	"follows.check_interval",
+}
+
+// ReloadHook 配置热加载成功后的回调，changed 为发生变化的配置项
+type ReloadHook func(cfg *Config, changed []string)
+
+var (
+	hooksMu sync.Mutex
+	hooks   []ReloadHook
+)
+
+// OnReload 注册热加载回调
+func OnReload(hook ReloadHook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, hook)
+}
+
+// WatchConfig 监听配置文件变化并自动热加载
+func WatchConfig() {
+	v := viper.New()
+	v.SetConfigFile(configFile)
+	v.SetConfigType("yaml")
+	v.OnConfigChange(func(e fsnotify.Event) {
+		Reload()
+	})
+	v.WatchConfig()
+
+	log.Info().Str("path", configFile).Msg("配置文件热加载已开启")
+}
+
+// Reload 重新读取配置文件，校验通过后整体替换当前配置
+// 校验失败时保留原配置，并在日志中输出本次修改的差异
+func Reload() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		log.Error().Err(err).Str("path", configFile).Msg("读取配置文件失败，保留原配置")
+		return err
+	}
+
+	cfg, flat, err := parse(data)
+	diff := diffSettings(settings, flat)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Strs("diff", diff).
+			Str("path", configFile).
+			Msg("配置校验失败，已拒绝本次修改")
+		return err
+	}
+	if len(diff) == 0 {
+		// 编辑器保存时可能触发多次事件，内容未变化时忽略
+		return nil
+	}
+
+	changed := changedKeys(settings, flat)
+	swap(cfg, flat)
+
+	log.Info().Strs("diff", diff).Msg("配置已热加载")
+	for _, key := range changed {
+		for _, rk := range restartKeys {
+			if strings.HasPrefix(key, rk) {
+				log.Warn().Str("key", key).Msg("该配置项需要重启服务才能生效")
+			}
+		}
+	}
+
+	hooksMu.Lock()
+	list := append([]ReloadHook(nil), hooks...)
+	hooksMu.Unlock()
+	for _, hook := range list {
+		hook(cfg, changed)
+	}
+	return nil
+}
+
+// ============ 差异对比 ============
+
+// 将嵌套配置展开为 a.b.c -> 值
+func flatten(settings map[string]any) map[string]string {
+	out := make(map[string]string)
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		switch val := v.(type) {
+		case map[string]any:
+			for k, child := range val {
+				walk(joinKey(prefix, k), child)
+			}
+		case []any:
+			for i, child := range val {
+				walk(joinKey(prefix, fmt.Sprint(i)), child)
+			}
+		default:
+			out[prefix] = fmt.Sprint(val)
+		}
+	}
+	walk("", settings)
+	return out
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// 发生变化的配置项（有序）
+func changedKeys(old, new map[string]string) []string {
+	var keys []string
+	for k, v := range new {
+		if ov, ok := old[k]; !ok || ov != v {
+			keys = append(keys, k)
+		}
+	}
+	for k := range old {
+		if _, ok := new[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 逐项输出差异，格式为 "key: 旧值 -> 新值"，密码和密钥不输出原文
+func diffSettings(old, new map[string]string) []string {
+	keys := changedKeys(old, new)
+	diff := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ov, ok := old[k]
+		if !ok {
+			ov = "(无)"
+		}
+		nv, ok := new[k]
+		if !ok {
+			nv = "(删除)"
+		}
+		if isSecretKey(k) {
+			ov, nv = "***", "***"
+		}
+		diff = append(diff, fmt.Sprintf("%s: %s -> %s", k, redactURL(ov), redactURL(nv)))
+	}
+	return diff
+}
+
+// 隐藏地址中的密码，如 cache.backend.redis_url、tracing.endpoint 中的认证信息
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	return u.Redacted()
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	// 代理地址可能包含认证信息
+	return strings.Contains(key, "password") || strings.Contains(key, "secret") || strings.Contains(key, "token") ||
+		strings.Contains(key, "proxy")
+}
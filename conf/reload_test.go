@@ -0,0 +1,38 @@
+package conf
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiffSettingsHidesSecrets(t *testing.T) {
+	old := map[string]string{
+		"cache.backend.redis_url": "redis://:oldpass@127.0.0.1:6379/0",
+		"app.password":            "old",
+		"proxy.default":           "socks5://u:p@127.0.0.1:1080",
+		"cache.search":            "1h0m0s",
+	}
+	new := map[string]string{
+		"cache.backend.redis_url": "redis://:newpass@127.0.0.1:6379/1",
+		"app.password":            "new",
+		"proxy.default":           "direct",
+		"cache.search":            "2h0m0s",
+	}
+
+	diff := diffSettings(old, new)
+	want := []string{
+		"app.password: *** -> ***",
+		"cache.backend.redis_url: redis://:xxxxx@127.0.0.1:6379/0 -> redis://:xxxxx@127.0.0.1:6379/1",
+		"cache.search: 1h0m0s -> 2h0m0s",
+		"proxy.default: *** -> ***",
+	}
+	if !slices.Equal(diff, want) {
+		t.Errorf("diff = %q, want %q", diff, want)
+	}
+	for _, line := range diff {
+		if strings.Contains(line, "pass@") || strings.Contains(line, "old") || strings.Contains(line, "new") {
+			t.Errorf("diff 包含敏感信息: %s", line)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"tv/models"
+	"tv/store"
+
+	"github.com/rs/zerolog/log"
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	ErrSourceExists   = errors.New("视频源已存在")
+	ErrSourceNotFound = errors.New("视频源不存在")
+)
+
+var sourceKeyRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ValidSourceKey 视频源 key 只能包含字母、数字、_ 和 -
+func ValidSourceKey(key string) bool {
+	return sourceKeyRe.MatchString(key)
+}
+
+// CreateSource 新增视频源
+func CreateSource(key string, source models.VideoSource) error {
+	return updateSource(key, &source, true)
+}
+
+// UpdateSource 修改已有的视频源
+func UpdateSource(key string, source models.VideoSource) error {
+	return updateSource(key, &source, false)
+}
+
+// DeleteSource 删除视频源
+func DeleteSource(key string) error {
+	return updateSource(key, nil, false)
+}
+
+// 写回配置文件后替换内存中的视频源表，source 为 nil 表示删除
+// 只改写 sources 下对应的条目，文件其余内容（包括注释）保持不变
+func updateSource(key string, source *models.VideoSource, create bool) error {
+	if !ValidSourceKey(key) {
+		return fmt.Errorf("视频源 key 格式错误: %q", key)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	_, exists := Get().Sources[key]
+	if create && exists {
+		return ErrSourceExists
+	}
+	if !create && !exists {
+		return ErrSourceNotFound
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	out, err := rewriteSource(data, key, source)
+	if err != nil {
+		return err
+	}
+
+	// 写入前按完整配置重新解析校验，确认文件仍然合法且条目与预期一致
+	cfg, flat, err := parse(out)
+	if err != nil {
+		return fmt.Errorf("写回配置文件失败: %w", err)
+	}
+	got, ok := cfg.Sources[key]
+	if (source == nil) == ok || (source != nil && got != *source) {
+		return errors.New("写回配置文件失败: 条目内容不一致")
+	}
+
+	if err := store.WriteFile(configFile, out); err != nil {
+		return err
+	}
+	// 直接替换快照，随后文件监听触发的重新加载检测不到差异，不会重复通知
+	swap(cfg, flat)
+
+	log.Info().
+		Str("source", key).
+		Bool("deleted", source == nil).
+		Str("path", configFile).
+		Msg("视频源配置已更新")
+	return nil
+}
+
+// 在配置文本中替换、新增或删除 sources.<key> 条目
+// 通过 yaml.Node 定位条目所在的行，只改写这些行，文件其余内容（包括注释和空行）保持不变；
+// 顶层或 sources 使用流式写法（{...}）时无法按行改写，改为修改节点树后重新生成整个文件
+func rewriteSource(data []byte, key string, source *models.VideoSource) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("配置文件顶层必须是映射")
+	}
+
+	idx := mappingIndex(root, "sources")
+	if idx >= 0 {
+		if v := root.Content[idx+1]; v.Kind != yaml.MappingNode && !isEmptyNull(v) {
+			return nil, errors.New("配置文件中的 sources 必须是映射")
+		}
+	}
+	if root.Style&yaml.FlowStyle != 0 || (idx >= 0 && root.Content[idx+1].Style&yaml.FlowStyle != 0) ||
+		(idx >= 0 && root.Content[idx+1].Kind == yaml.ScalarNode && root.Content[idx+1].Value != "") {
+		return rewriteTree(&doc, idx, key, source)
+	}
+
+	lines := strings.Split(string(data), "\n")
+	if idx < 0 {
+		if source == nil {
+			return nil, ErrSourceNotFound
+		}
+		if n := len(lines); n > 0 && lines[n-1] == "" {
+			lines = lines[:n-1]
+		}
+		lines = append(lines, "", "sources:")
+		lines = append(lines, renderSource("  ", 2, plainKey(key), *source)...)
+		lines = append(lines, "")
+		return []byte(strings.Join(lines, "\n")), nil
+	}
+
+	sourcesKey, sources := root.Content[idx], root.Content[idx+1]
+	// sources 段结束的行（不含）：下一个顶层 key 所在行
+	end := len(lines)
+	if idx+2 < len(root.Content) {
+		end = root.Content[idx+2].Line - 1
+	}
+
+	// 没有任何条目（sources: 后为空）时直接写在 sources: 的下一行
+	if sources.Kind != yaml.MappingNode || len(sources.Content) == 0 {
+		if source == nil {
+			return nil, ErrSourceNotFound
+		}
+		at := sourcesKey.Line
+		return splice(lines, at, at, renderSource("  ", 2, plainKey(key), *source)), nil
+	}
+
+	// 子项缩进取第一个条目的缩进
+	indent := strings.Repeat(" ", sources.Content[0].Column-1)
+	step := max(len(indent), 2)
+
+	for i := 0; i < len(sources.Content); i += 2 {
+		k, v := sources.Content[i], sources.Content[i+1]
+		if k.Value != key {
+			continue
+		}
+		boundary := end
+		if i+2 < len(sources.Content) {
+			boundary = sources.Content[i+2].Line - 1
+		}
+		first := k.Line - 1
+		last := lastContentLine(lines, first, boundary)
+
+		if source == nil {
+			return splice(lines, first, last+1, nil), nil
+		}
+		if v.Kind == yaml.MappingNode && v.Style&yaml.FlowStyle == 0 && len(v.Content) > 0 {
+			step = v.Content[0].Column - k.Column
+		}
+		head := &yaml.Node{Kind: yaml.ScalarNode, Value: key, Style: k.Style, LineComment: k.LineComment}
+		return splice(lines, first, last+1, renderSource(indent, step, head, *source)), nil
+	}
+
+	if source == nil {
+		return nil, ErrSourceNotFound
+	}
+
+	// 新条目追加到最后一个条目之后，条目后的注释和空行保留在新条目之后
+	lastKey := sources.Content[len(sources.Content)-2]
+	at := lastContentLine(lines, lastKey.Line-1, end) + 1
+	insert := append([]string{""}, renderSource(indent, step, plainKey(key), *source)...)
+	return splice(lines, at, at, insert), nil
+}
+
+// 流式写法：修改节点树后重新生成整个文件
+func rewriteTree(doc *yaml.Node, idx int, key string, source *models.VideoSource) ([]byte, error) {
+	root := doc.Content[0]
+	if idx < 0 {
+		if source == nil {
+			return nil, ErrSourceNotFound
+		}
+		root.Content = append(root.Content, plainKey("sources"), &yaml.Node{Kind: yaml.MappingNode})
+		idx = len(root.Content) - 2
+	}
+	sources := root.Content[idx+1]
+	if sources.Kind != yaml.MappingNode {
+		sources = &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+		root.Content[idx+1] = sources
+	}
+
+	i := mappingIndex(sources, key)
+	switch {
+	case i >= 0 && source == nil:
+		sources.Content = append(sources.Content[:i], sources.Content[i+2:]...)
+	case i >= 0:
+		sources.Content[i+1] = sourceNode(*source)
+	case source == nil:
+		return nil, ErrSourceNotFound
+	default:
+		sources.Content = append(sources.Content, plainKey(key), sourceNode(*source))
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 映射中 key 所在的下标，不存在时返回 -1
+func mappingIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// "sources:" 后没有任何内容
+func isEmptyNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.Tag == "!!null"
+}
+
+// 条目占用的最后一行：从 first 到 boundary（不含）之间最后一个不是空行或注释的行
+// 条目之后的注释（如注释掉的字段、下一个条目的说明）不属于该条目，改写时保留
+func lastContentLine(lines []string, first, boundary int) int {
+	last := first
+	for i := first + 1; i < boundary && i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			last = i
+		}
+	}
+	return last
+}
+
+// 用 insert 替换 lines[from:to]
+func splice(lines []string, from, to int, insert []string) []byte {
+	out := make([]string, 0, len(lines)-(to-from)+len(insert))
+	out = append(out, lines[:from]...)
+	out = append(out, insert...)
+	out = append(out, lines[to:]...)
+	return []byte(strings.Join(out, "\n"))
+}
+
+func plainKey(key string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: key}
+}
+
+// 生成 "key: 条目" 的文本，每行加上 indent，step 为下一级的缩进宽度
+func renderSource(indent string, step int, key *yaml.Node, source models.VideoSource) []string {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(step)
+	enc.Encode(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{key, sourceNode(source)}})
+	enc.Close()
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	for i := range lines {
+		lines[i] = indent + lines[i]
+	}
+	return lines
+}
+
+// 视频源条目对应的节点，只写入非零值的字段
+func sourceNode(source models.VideoSource) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(name, tag, value string, style yaml.Style) {
+		n.Content = append(n.Content,
+			plainKey(name),
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Style: style})
+	}
+	str := func(name, value string) {
+		add(name, "!!str", value, yaml.DoubleQuotedStyle)
+	}
+
+	str("api", source.API)
+	str("name", source.Name)
+	if source.Detail != "" {
+		str("detail", source.Detail)
+	}
+	if source.Adult {
+		add("adult", "!!bool", "true", 0)
+	}
+	if source.Disabled {
+		add("disabled", "!!bool", "true", 0)
+	}
+	if source.RateLimit != 0 {
+		add("rate_limit", "!!float", strconv.FormatFloat(source.RateLimit, 'g', -1, 64), 0)
+	}
+	if source.Burst != 0 {
+		add("burst", "!!int", strconv.Itoa(source.Burst), 0)
+	}
+	if source.Proxy != "" {
+		str("proxy", source.Proxy)
+	}
+	return n
+}
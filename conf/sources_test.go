@@ -0,0 +1,156 @@
+package conf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"tv/models"
+)
+
+const sourcesYAML = `app:
+  mode: debug # 运行模式
+
+# 视频源
+sources:
+
+  a: # 源 A
+    api: "https://a.example.com/api"
+    name: "A"
+    # rate_limit: 2
+
+  "b":	# 源 B
+    api: https://b.example.com/api
+    name: B
+
+  # c:
+  #   api: "https://c.example.com/api"
+
+log:
+  level: info
+`
+
+func TestRewriteSourceKeepsRestOfFile(t *testing.T) {
+	updated := &models.VideoSource{API: "https://a2.example.com/api", Name: "A2", Adult: true, RateLimit: 1.5}
+
+	tests := []struct {
+		name   string
+		key    string
+		source *models.VideoSource
+		want   string
+	}{
+		{"replace", "a", updated, strings.Replace(sourcesYAML, `  a: # 源 A
+    api: "https://a.example.com/api"
+    name: "A"
+`, `  a: # 源 A
+    api: "https://a2.example.com/api"
+    name: "A2"
+    adult: true
+    rate_limit: 1.5
+`, 1)},
+		{"replace quoted key with tab", "b", updated, strings.Replace(sourcesYAML, `  "b":	# 源 B
+    api: https://b.example.com/api
+    name: B
+`, `  "b": # 源 B
+    api: "https://a2.example.com/api"
+    name: "A2"
+    adult: true
+    rate_limit: 1.5
+`, 1)},
+		{"delete", "a", nil, strings.Replace(sourcesYAML, `  a: # 源 A
+    api: "https://a.example.com/api"
+    name: "A"
+`, "", 1)},
+		{"create", "d", &models.VideoSource{API: "https://d.example.com/api", Name: "D", Proxy: "direct"}, strings.Replace(sourcesYAML, `    name: B
+`, `    name: B
+
+  d:
+    api: "https://d.example.com/api"
+    name: "D"
+    proxy: "direct"
+`, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := rewriteSource([]byte(sourcesYAML), tt.key, tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", out, tt.want)
+			}
+			checkSources(t, out, tt.key, tt.source)
+		})
+	}
+}
+
+func TestRewriteSourceLayouts(t *testing.T) {
+	source := &models.VideoSource{API: "https://new.example.com/api?ac=list&x=\"1\"", Name: "新 源: #1"}
+
+	tests := []struct {
+		name string
+		yaml string
+		key  string
+	}{
+		{"flow sources replace", "sources: {a: {api: \"https://a.example.com\", name: A}, b: {api: \"https://b.example.com\", name: B}}\n", "a"},
+		{"flow sources create", "sources: {a: {api: \"https://a.example.com\", name: A}}\n", "n"},
+		{"flow entry", "sources:\n  a: {api: \"https://a.example.com\", name: A}\n  b:\n    api: \"https://b.example.com\"\n    name: B\n", "a"},
+		{"flow root", "{app: {mode: debug}, sources: {a: {api: \"https://a.example.com\", name: A}}}\n", "n"},
+		{"four space indent", "sources:\n    a:\n        api: \"https://a.example.com\"\n        name: A\n", "a"},
+		{"four space indent create", "sources:\n    a:\n        api: \"https://a.example.com\"\n        name: A\n", "n"},
+		{"empty sources", "app:\n  mode: debug\nsources:\n  # 暂无\nlog:\n  level: info\n", "n"},
+		{"null sources", "sources: ~\n", "n"},
+		{"no sources", "app:\n  mode: debug\n", "n"},
+		{"empty file", "", "n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := rewriteSource([]byte(tt.yaml), tt.key, source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkSources(t, out, tt.key, source)
+		})
+	}
+}
+
+func TestRewriteSourceFlowDelete(t *testing.T) {
+	out, err := rewriteSource([]byte("sources: {a: {api: \"https://a.example.com\", name: A}, b: {api: \"https://b.example.com\", name: B}}\n"), "a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSources(t, out, "a", nil)
+	checkSources(t, out, "b", &models.VideoSource{API: "https://b.example.com", Name: "B"})
+}
+
+func TestRewriteSourceNotFound(t *testing.T) {
+	for _, data := range []string{sourcesYAML, "app:\n  mode: debug\n", "sources: {}\n"} {
+		if _, err := rewriteSource([]byte(data), "missing", nil); !errors.Is(err, ErrSourceNotFound) {
+			t.Errorf("delete missing in %q: err = %v", data, err)
+		}
+	}
+	if _, err := rewriteSource([]byte("sources: [a, b]\n"), "a", &models.VideoSource{}); err == nil {
+		t.Error("sources 不是映射时应返回错误")
+	}
+}
+
+// 按完整配置解析改写后的文件，检查条目内容
+func checkSources(t *testing.T, data []byte, key string, want *models.VideoSource) {
+	t.Helper()
+	cfg, _, err := parse(data)
+	if err != nil && want != nil {
+		t.Fatalf("改写后的配置无法解析: %v\n%s", err, data)
+	}
+	if cfg == nil {
+		return
+	}
+	got, ok := cfg.Sources[key]
+	if want == nil {
+		if ok {
+			t.Errorf("sources.%s 未删除:\n%s", key, data)
+		}
+		return
+	}
+	if !ok || got != *want {
+		t.Errorf("sources.%s = %+v, want %+v\n%s", key, got, *want, data)
+	}
+}
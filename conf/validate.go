@@ -0,0 +1,203 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"tv/models"
+
+	"github.com/rs/zerolog"
+)
+
+// Validate 检查配置是否合法，一次返回所有错误
+func (cfg *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.App.Mode == "debug" || cfg.App.Mode == "release", "app.mode 只能是 debug 或 release: %s", cfg.App.Mode)
+	check(cfg.App.GateTTL > 0, "app.gate_ttl 必须大于 0")
+
+	if cfg.Server.Addr != "" {
+		_, port, err := net.SplitHostPort(cfg.Server.Addr)
+		check(err == nil && validPort(port), "server.addr 格式错误，应为 host:port 或 :port: %s", cfg.Server.Addr)
+	} else {
+		check(validPort(cfg.App.Port), "app.port 必须是 1-65535 之间的端口号: %s", cfg.App.Port)
+	}
+	check(cfg.Server.BasePath == "" || strings.HasPrefix(cfg.Server.BasePath, "/"), "server.base_path 必须以 / 开头: %s", cfg.Server.BasePath)
+	check(strings.HasPrefix(cfg.Server.APIPrefix, "/"), "server.api_prefix 必须以 / 开头且不能为 /: %s", cfg.Server.APIPrefix)
+	check(cfg.Server.ShutdownTimeout > 0, "server.shutdown_timeout 必须大于 0")
+	for i, origin := range cfg.Server.CORSOrigins {
+		check(origin == "*" || isHTTPURL(origin), "server.cors_origins[%d] 必须是 * 或 http(s) 地址: %s", i, origin)
+	}
+	if cfg.Metrics.Enabled {
+		check(strings.HasPrefix(cfg.Metrics.Path, "/") && cfg.Metrics.Path != "/", "metrics.path 必须以 / 开头且不能为 /: %s", cfg.Metrics.Path)
+		check(!strings.HasPrefix(cfg.Metrics.Path+"/", cfg.Server.APIPrefix+"/"), "metrics.path 不能位于 server.api_prefix 下: %s", cfg.Metrics.Path)
+	}
+	switch cfg.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		check(false, "tracing.exporter 只能是 none、stdout 或 otlp: %s", cfg.Tracing.Exporter)
+	}
+	check(cfg.Tracing.Endpoint == "" || isHTTPURL(cfg.Tracing.Endpoint), "tracing.endpoint 必须是 http(s) 地址: %s", cfg.Tracing.Endpoint)
+	check(cfg.Tracing.SampleRatio >= 0 && cfg.Tracing.SampleRatio <= 1, "tracing.sample_ratio 必须在 0 到 1 之间: %v", cfg.Tracing.SampleRatio)
+	if cfg.Log.Level != "" {
+		_, err := zerolog.ParseLevel(cfg.Log.Level)
+		check(err == nil, "log.level 无效: %s", cfg.Log.Level)
+	}
+
+	check(cfg.Cache.Search >= 0, "cache.search 不能为负数")
+	check(cfg.Cache.ID >= 0, "cache.id 不能为负数")
+	check(cfg.Cache.Hot >= 0, "cache.hot 不能为负数")
+	check(cfg.Cache.Stale.Search >= 0, "cache.stale.search 不能为负数")
+	check(cfg.Cache.Stale.ID >= 0, "cache.stale.id 不能为负数")
+	check(cfg.Cache.Stale.Hot >= 0, "cache.stale.hot 不能为负数")
+	check(cfg.Cache.Negative >= 0, "cache.negative 不能为负数")
+	check(cfg.Search.Deadline >= 0, "search.deadline 不能为负数")
+	check(cfg.Upstream.MaxWait >= 0, "upstream.max_wait 不能为负数")
+	checkLimit := func(name string, l RateLimit) {
+		check(l.Rate >= 0, "%s.rate 不能为负数", name)
+		check(l.Burst >= 0, "%s.burst 不能为负数", name)
+	}
+	checkLimit("upstream.sources", cfg.Upstream.Sources)
+	checkLimit("upstream.douban", cfg.Upstream.Douban)
+	checkLimit("upstream.omofun", cfg.Upstream.Omofun)
+	check(ValidProxy(cfg.Proxy.Default), "proxy.default 必须是 http(s)、socks5(h) 地址或 direct")
+	check(ValidProxy(cfg.Proxy.Douban), "proxy.douban 必须是 http(s)、socks5(h) 地址或 direct")
+	check(ValidProxy(cfg.Proxy.Omofun), "proxy.omofun 必须是 http(s)、socks5(h) 地址或 direct")
+	check(cfg.Cache.Limits.MaxEntries >= 0, "cache.limits.max_entries 不能为负数")
+	check(cfg.Cache.Limits.MaxMemoryMB >= 0, "cache.limits.max_memory_mb 不能为负数")
+	for typ, quota := range cfg.Cache.Limits.Quotas {
+		check(quota >= 0 && quota <= 100, "cache.limits.quotas.%s 必须在 0-100 之间", typ)
+	}
+	switch cfg.Cache.Backend.Type {
+	case "memory", "disk":
+	case "redis":
+		check(cfg.Cache.Backend.RedisURL != "", "cache.backend.redis_url 不能为空")
+	default:
+		check(false, "cache.backend.type 只能是 memory、disk 或 redis: %s", cfg.Cache.Backend.Type)
+	}
+
+	check(cfg.Users.SessionTTL > 0, "users.session_ttl 必须大于 0")
+	check(cfg.History.MaxItems >= 0, "history.max_items 不能为负数")
+	check(cfg.Follows.CheckInterval >= 0, "follows.check_interval 不能为负数")
+	check(cfg.Follows.MaxUpdates >= 0, "follows.max_updates 不能为负数")
+
+	check(cfg.Probe.Concurrency > 0, "probe.concurrency 必须大于 0")
+	check(cfg.Probe.Timeout > 0, "probe.timeout 必须大于 0")
+	check(cfg.Probe.TTL >= 0, "probe.ttl 不能为负数")
+
+	names := make(map[string]bool)
+	for i, hook := range cfg.Webhooks {
+		check(hook.Name != "", "webhooks[%d].name 不能为空", i)
+		check(!names[hook.Name], "webhooks[%d].name 重复: %s", i, hook.Name)
+		check(isHTTPURL(hook.URL), "webhooks[%d].url 必须是 http(s) 地址", i)
+		check(hook.Timeout >= 0, "webhooks[%d].timeout 不能为负数", i)
+		check(hook.MaxRetries >= 0, "webhooks[%d].max_retries 不能为负数", i)
+		names[hook.Name] = true
+	}
+
+	check(len(cfg.Sources) > 0, "sources 至少需要配置一个视频源")
+	keys := make([]string, 0, len(cfg.Sources))
+	for key := range cfg.Sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		src := cfg.Sources[key]
+		check(ValidSourceKey(key), "sources.%s: key 只能包含字母、数字、_ 和 -", key)
+		check(src.Name != "", "sources.%s.name 不能为空", key)
+		check(isHTTPURL(src.API), "sources.%s.api 必须是 http(s) 地址", key)
+		check(src.RateLimit >= 0, "sources.%s.rate_limit 不能为负数", key)
+		check(src.Burst >= 0, "sources.%s.burst 不能为负数", key)
+		check(ValidProxy(src.Proxy), "sources.%s.proxy 必须是 http(s)、socks5(h) 地址或 direct", key)
+	}
+	if err := SourceProxyConflicts(cfg.Sources); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// SourceProxyConflicts 检查共用主机的视频源是否设置了不同的代理
+// 代理按主机选择，同一主机只能使用一个代理，未设置（使用 proxy.default）也视为一种取值
+func SourceProxyConflicts(sources map[string]models.VideoSource) error {
+	keys := make([]string, 0, len(sources))
+	for key := range sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	first := make(map[string]string) // 主机 -> 第一个使用该主机的源
+	for _, key := range keys {
+		u, err := url.Parse(sources[key].API)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		prev, ok := first[u.Host]
+		if !ok {
+			first[u.Host] = key
+			continue
+		}
+		if a, b := sources[prev].Proxy, sources[key].Proxy; a != b {
+			errs = append(errs, fmt.Errorf("sources.%s.proxy 与 sources.%s.proxy 不同（%s / %s），两者的主机都是 %s，共用主机的视频源需设置相同的代理",
+				prev, key, proxyLabel(a), proxyLabel(b), u.Host))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 错误信息中的代理地址，隐藏密码
+func proxyLabel(s string) string {
+	if s == "" {
+		return "未设置"
+	}
+	if u, err := url.Parse(s); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return s
+}
+
+// 统一路径格式，去掉末尾的 /
+func (cfg *Config) normalize() {
+	cfg.App.Mode = strings.ToLower(cfg.App.Mode)
+	cfg.Server.BasePath = strings.TrimRight(cfg.Server.BasePath, "/")
+	cfg.Server.APIPrefix = strings.TrimRight(cfg.Server.APIPrefix, "/")
+	cfg.Log.Level = strings.ToLower(cfg.Log.Level)
+	cfg.Metrics.Path = strings.TrimRight(cfg.Metrics.Path, "/")
+	cfg.Tracing.Exporter = strings.ToLower(cfg.Tracing.Exporter)
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// ValidProxy 代理地址是否合法，为空表示未设置
+func ValidProxy(s string) bool {
+	if s == "" || s == "direct" {
+		return true
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return true
+	}
+	return false
+}
@@ -2,7 +2,7 @@ import axios from 'axios'
 
 // 创建 axios 实例
 const api = axios.create({
-  baseURL: '/api/v1',
+  baseURL: `${import.meta.env.BASE_URL}api/v1`, // 子路径部署时构建参数 VITE_BASE_PATH 需与后端 server.base_path 一致
   timeout: 30000, // 并行请求多个源，增加超时时间
   headers: {
     'Content-Type': 'application/json',
@@ -64,9 +64,10 @@ export interface VodItem {
 }
 
 export interface Episode {
-  episode_index: number
+  episode_index: number // 源中的原始位置，按集数排序后与数组下标不一定一致
   episode_title: string
   url: string
+  label?: string // 归一化标题，如 第1集
 }
 
 // 统一信息
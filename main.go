@@ -1,61 +1,278 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"io"
+	"net"
+	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
+	"time"
+	"tv/cache"
 	"tv/conf"
+	"tv/metrics"
+	"tv/server"
 	"tv/service"
+	"tv/tracing"
+	"tv/webhook"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/Yuelioi/gkit/logx/zero"
 	"github.com/Yuelioi/gkit/web/gin/middleware/cachecontrol"
 	"github.com/Yuelioi/gkit/web/gin/middleware/log/gzero"
 	"github.com/Yuelioi/gkit/web/gin/middleware/ratelimit"
-	"github.com/Yuelioi/gkit/web/gin/server"
 )
 
 func main() {
 
-	// 配置日志
-	logger := zero.Default()
+	// 配置日志（带有 Ctx 的日志附加 trace_id）
+	logger := zero.Default().Hook(tracing.LogHook{})
 	log.Logger = logger
 
-	// 初始化配置
-	if err := conf.InitConfig("data/config.yaml"); err != nil {
-		log.Fatal().Msg("加载配置失败")
-		panic(err)
+	// 初始化配置：默认值 < 配置文件 < 环境变量 YTV_* < 命令行参数
+	conf.ParseFlags(os.Args[1:])
+	if err := conf.InitConfig(conf.ConfigPath()); err != nil {
+		log.Error().Msg("加载配置失败，请修正以上错误后重启")
+		os.Exit(1)
 	}
+	cfg := conf.Get()
+	setLogLevel(cfg)
+
+	// 链路追踪
+	shutdownTracing, err := tracing.Init(tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("链路追踪初始化失败")
+		os.Exit(1)
+	}
+
+	// 上游按主机限速和代理
+	service.ApplyUpstream(cfg)
+
+	// 配置文件热加载
+	conf.OnReload(func(cfg *conf.Config, changed []string) {
+		setLogLevel(cfg)
+		service.ApplyUpstream(cfg)
+		webhook.Emit(webhook.EventConfigReloaded, gin.H{"changed": changed})
+	})
+	conf.WatchConfig()
+
+	// 初始化用户存储（首次启动时创建管理员）
+	service.GetUserStore()
+
+	// 请求和后台任务的 Context 都派生自 baseCtx，退出超时后取消它以中止未完成的上游请求
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+
+	// 定期检查追剧更新
+	service.StartFollowChecker(baseCtx)
 
 	// 禁用gin log
 	gin.DefaultWriter = io.Discard
 	gin.DefaultErrorWriter = io.Discard
 
+	if cfg.App.Mode == "release" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// 开发模式未配置跨域来源时允许全部来源
+	origins := cfg.Server.CORSOrigins
+	if len(origins) == 0 && cfg.App.Mode != "release" {
+		origins = []string{"*"}
+	}
+
 	mw := []gin.HandlerFunc{
+		metrics.Middleware(),
+		tracing.Middleware(cfg.Tracing.ServiceName),
 		gzero.Default(logger),
 		gzero.GinRecovery(logger),
+		service.Gate(cfg.APIPath()),
 		// cachecontrol.Default(),
 		ratelimit.Default(),
 	}
 
-	server.Start(server.ServerConfig{
-		Addr:        ":9000",
-		Logger:      logger,
-		Mode:        strings.ToLower(os.Getenv("APP_MODE")),
-		EnableCORS:  true,
-		APIPrefix:   "/api/v1",
+	srvCfg := server.Config{
+		Addr:        cfg.ListenAddr(),
+		BasePath:    cfg.Server.BasePath,
+		APIPrefix:   cfg.Server.APIPrefix,
+		SPAPath:     cfg.Server.SPAPath,
+		CORSOrigins: origins,
 		Middlewares: mw,
-		SPAPath:     "./frontend/dist",
-	}, func(api *gin.RouterGroup) {
+	}
+	if cfg.Metrics.Enabled {
+		srvCfg.MetricsPath = cfg.Metrics.Path
+		srvCfg.Metrics = metrics.Handler(cfg.Metrics.Token)
+		srvCfg.MetricsGuard = service.MetricsGuard(cfg)
+	}
+
+	srv := server.New(srvCfg, func(api *gin.RouterGroup) {
+
+		api.Use(ratelimit.Default(), service.LoadUser())
+		noStore := cachecontrol.NewBuilder().NoStore().Build()
+
+		api.GET("/health", noStore, service.Health)
+		// 接口文档，新增或修改路由时同步更新 service/openapi.go
+		api.GET("/openapi.json", service.OpenAPI)
+
+		// 访问密码
+		gate := api.Group("/gate", noStore)
+		{
+			gate.POST("/login", service.GateLogin)
+			gate.POST("/logout", service.GateLogout)
+		}
+
+		// 公共查询接口，允许浏览器缓存
+		query := api.Group("", cachecontrol.Default())
+		{
+			query.GET("/search", service.SearchVideoAPI)
+			query.GET("/hot", service.HotMovies)
+			query.GET("/vod", service.SearchVideoById)
+		}
+
+		// 播放记录
+		history := api.Group("/history", noStore)
+		{
+			history.GET("", service.ListHistory)
+			history.POST("", service.SaveHistory)
+			history.POST("/sync", service.SyncHistory)
+			history.DELETE("", service.DeleteHistory)
+			history.DELETE("/all", service.ClearHistory)
+		}
+
+		// 收藏与追剧
+		follows := api.Group("/follows", noStore)
+		{
+			follows.GET("", service.ListFollows)
+			follows.POST("", service.SaveFollow)
+			follows.DELETE("", service.DeleteFollow)
+			follows.GET("/updates", service.ListFollowUpdates)
+			follows.POST("/updates/read", service.ReadFollowUpdates)
+		}
 
-		api.Use((cachecontrol.Default()), ratelimit.Default())
+		// 登录与账号
+		auth := api.Group("/auth", noStore)
 		{
-			api.GET("/search", service.SearchVideoAPI)
-			api.GET("/hot", service.HotMovies)
-			api.GET("/vod", service.SearchVideoById)
+			auth.POST("/register", service.Register)
+			auth.POST("/login", service.Login)
+			auth.POST("/logout", service.Logout)
+			auth.GET("/me", service.RequireUser(), service.Me)
+			auth.PUT("/password", service.RequireUser(), service.ChangePassword)
+		}
+
+		// 档案（当前用户）
+		profiles := api.Group("/profiles", noStore, service.RequireUser())
+		{
+			profiles.GET("", service.ListProfiles)
+			profiles.POST("", service.SaveProfile)
+			profiles.PUT("/:id", service.SaveProfile)
+			profiles.DELETE("/:id", service.DeleteProfile)
+		}
+
+		// 管理接口（管理员）
+		admin := api.Group("/admin", noStore, service.RequireAdmin())
+		{
+			admin.GET("/cache", service.CacheStats)
+			admin.GET("/cache/keys", service.ListCacheKeys)
+			admin.DELETE("/cache/key", service.DeleteCacheKey)
+			admin.DELETE("/cache/:type", service.ClearCache)
+			admin.POST("/cache/refresh/search", service.RefreshSearchCache)
+			admin.POST("/cache/refresh/vod", service.RefreshIDCache)
+			admin.POST("/cache/refresh/hot", service.RefreshHotCache)
+
+			admin.GET("/sources", service.ListSources)
+			admin.POST("/sources", service.CreateSource)
+			admin.PUT("/sources/:key", service.UpdateSource)
+			admin.DELETE("/sources/:key", service.DeleteSource)
+			admin.POST("/sources/:key/enable", service.EnableSource)
+			admin.POST("/sources/:key/disable", service.DisableSource)
+			admin.POST("/sources/:key/test", service.TestSource)
+
+			admin.GET("/webhooks", service.ListWebhooks)
+			admin.GET("/webhooks/deliveries", service.ListWebhookDeliveries)
+			admin.POST("/webhooks/:name/test", service.TestWebhook)
+		}
+
+		// 用户管理（管理员）
+		users := api.Group("/users", noStore, service.RequireAdmin())
+		{
+			users.GET("", service.ListUsers)
+			users.POST("", service.CreateUser)
+			users.DELETE("/:id", service.DeleteUser)
+			users.PUT("/:id/password", service.ResetUserPassword)
 		}
 	})
 
+	srv.BaseContext = func(net.Listener) context.Context { return baseCtx }
+
+	log.Info().
+		Str("addr", srv.Addr).
+		Str("base_path", cfg.Server.BasePath).
+		Str("api", cfg.APIPath()).
+		Str("mode", cfg.App.Mode).
+		Msg("服务启动")
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Msg("服务异常退出")
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	shutdown(srv, cancelRequests, shutdownTracing)
+}
+
+// 优雅退出：停止接收新请求并等待进行中的请求，超过 server.shutdown_timeout 后取消剩余的上游请求
+func shutdown(srv *http.Server, cancelRequests context.CancelFunc, shutdownTracing func(context.Context) error) {
+	timeout := conf.Get().Server.ShutdownTimeout
+	log.Info().Dur("timeout", timeout).Msg("正在退出，等待进行中的请求")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Warn().Err(err).Msg("等待请求超时，取消未完成的上游请求")
+		cancelRequests()
+		srv.Close()
+	}
+	cancelRequests()
+
+	// 写入延迟保存的播放进度
+	if err := service.GetHistoryStore().Flush(); err != nil {
+		log.Error().Err(err).Msg("保存播放记录失败")
+	}
+
+	// 停止 Webhook 推送的重试
+	webhook.GetDispatcher().Close()
+
+	// 取消后台刷新等不属于任何请求的上游请求，并关闭缓存后端
+	if err := cache.GetCacher().Close(); err != nil {
+		log.Error().Err(err).Msg("关闭缓存失败")
+	}
+
+	ctx, cancelTracing := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTracing()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error().Err(err).Msg("上报剩余的链路追踪数据失败")
+	}
+	log.Info().Msg("服务已退出")
+}
+
+// 日志级别：未配置时 release 模式为 info，其他为 debug
+func setLogLevel(cfg *conf.Config) {
+	level := zerolog.DebugLevel
+	if cfg.App.Mode == "release" {
+		level = zerolog.InfoLevel
+	}
+	if cfg.Log.Level != "" {
+		level, _ = zerolog.ParseLevel(cfg.Log.Level)
+	}
+	zerolog.SetGlobalLevel(level)
 }
@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ytv"
+
+// 使用独立的 Registry，只暴露本服务的指标和 Go 运行时指标
+var registry = prometheus.NewRegistry()
+
+var factory = promauto.With(registry)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// ============ HTTP ============
+
+var (
+	httpRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP 请求数",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP 请求耗时",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// Middleware 按路由模板统计请求数和耗时，未匹配路由的请求（前端页面、404）归为 unmatched
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler 指标接口，token 不为空时要求请求头 Authorization: Bearer <token>
+func Handler(token string) http.Handler {
+	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+	if token == "" {
+		return h
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ============ 视频源 ============
+
+var (
+	upstreamDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "视频源请求耗时（包括 Omo 页面抓取）",
+		Buckets:   []float64{.1, .25, .5, 1, 2, 3, 5, 8, 13},
+	}, []string{"source"})
+
+	upstreamErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "视频源请求失败次数",
+	}, []string{"source"})
+
+	fanoutsInFlight = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "search_fanouts_in_flight",
+		Help:      "正在进行的多源关键词搜索数",
+	})
+)
+
+// ObserveUpstream 记录一次视频源请求，被取消的请求不计入失败次数
+func ObserveUpstream(source string, duration time.Duration, err error) {
+	upstreamDuration.WithLabelValues(source).Observe(duration.Seconds())
+	if err != nil && !errors.Is(err, context.Canceled) {
+		upstreamErrors.WithLabelValues(source).Inc()
+	}
+}
+
+var upstreamThrottled = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "upstream_throttled_total",
+	Help:      "上游限速次数，reason 为 429（上游要求降速）、retry_after 或 queue_timeout（本地排队超时未发出）",
+}, []string{"host", "reason"})
+
+// UpstreamThrottled 记录一次上游限速
+func UpstreamThrottled(host, reason string) {
+	upstreamThrottled.WithLabelValues(host, reason).Inc()
+}
+
+// FanoutStarted 开始一次多源搜索，返回的函数在搜索结束时调用
+func FanoutStarted() func() {
+	fanoutsInFlight.Inc()
+	return fanoutsInFlight.Dec
+}
+
+// ============ 缓存 ============
+
+var (
+	cacheHits = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_hits_total",
+		Help:      "缓存命中次数，stale 表示命中已过期但仍可返回的旧数据",
+	}, []string{"type", "stale"})
+
+	cacheMisses = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_misses_total",
+		Help:      "缓存未命中次数",
+	}, []string{"type"})
+
+	cacheEvictions = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_evictions_total",
+		Help:      "内存缓存因容量限制淘汰的条目数",
+	}, []string{"type"})
+
+	cacheCoalesced = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_coalesced_total",
+		Help:      "与相同的进行中请求合并、未访问上游的请求数",
+	}, []string{"type"})
+)
+
+func CacheHit(cacheType string, stale bool) {
+	cacheHits.WithLabelValues(cacheType, strconv.FormatBool(stale)).Inc()
+}
+
+func CacheMiss(cacheType string) {
+	cacheMisses.WithLabelValues(cacheType).Inc()
+}
+
+func CacheEvicted(cacheType string) {
+	cacheEvictions.WithLabelValues(cacheType).Inc()
+}
+
+func CacheCoalesced(cacheType string, waiters int) {
+	cacheCoalesced.WithLabelValues(cacheType).Add(float64(waiters))
+}
+
+// ============ 豆瓣 ============
+
+var doubanRequests = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "douban_requests_total",
+	Help:      "豆瓣接口请求结果：success、error（网络错误）、bad_status、bad_body",
+}, []string{"endpoint", "outcome"})
+
+var doubanDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "douban_request_duration_seconds",
+	Help:      "豆瓣接口请求耗时",
+	Buckets:   []float64{.1, .25, .5, 1, 2, 3, 5, 8},
+}, []string{"endpoint"})
+
+// ObserveDouban 记录一次豆瓣请求
+func ObserveDouban(endpoint, outcome string, duration time.Duration) {
+	doubanRequests.WithLabelValues(endpoint, outcome).Inc()
+	doubanDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+}
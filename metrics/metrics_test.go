@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func scrape(h http.Handler, auth string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandlerToken(t *testing.T) {
+	h := Handler("s3cret")
+	tests := []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"s3cret", http.StatusUnauthorized},
+		{"Basic s3cret", http.StatusUnauthorized},
+		{"Bearer s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := scrape(h, tt.auth); w.Code != tt.want {
+			t.Errorf("Authorization %q = %d, want %d", tt.auth, w.Code, tt.want)
+		}
+	}
+
+	FanoutStarted()()
+	w := scrape(h, "Bearer s3cret")
+	if !strings.Contains(w.Body.String(), "ytv_search_fanouts_in_flight") {
+		t.Errorf("metrics output missing ytv_ metrics:\n%s", w.Body.String())
+	}
+}
+
+func TestHandlerWithoutToken(t *testing.T) {
+	// 未设置令牌时不校验（由调用方决定是否套用访问密码）
+	if w := scrape(Handler(""), ""); w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+}
+
+func TestMiddlewareLabelsRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/api/v1/vod/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	matched := httpRequests.WithLabelValues("GET", "/api/v1/vod/:id", "200")
+	unmatched := httpRequests.WithLabelValues("GET", "unmatched", "404")
+	before, beforeUnmatched := testutil.ToFloat64(matched), testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/api/v1/vod/1", "/api/v1/vod/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// 按路由模板而不是实际路径统计，未匹配的请求归为 unmatched
+	if got := testutil.ToFloat64(matched) - before; got != 2 {
+		t.Errorf("route requests = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(unmatched) - beforeUnmatched; got != 1 {
+		t.Errorf("unmatched requests = %v, want 1", got)
+	}
+}
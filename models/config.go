@@ -1,9 +1,41 @@
 package models
 
+import "time"
+
 // 视频源配置
 type VideoSource struct {
-	API    string `mapstructure:"api" json:"api"`
-	Name   string `mapstructure:"name" json:"name"`
-	Detail string `mapstructure:"detail,omitempty" json:"detail,omitempty"`
-	Adult  bool   `mapstructure:"adult" json:"adult,omitempty"`
+	API      string `mapstructure:"api" json:"api"`
+	Name     string `mapstructure:"name" json:"name"`
+	Detail   string `mapstructure:"detail,omitempty" json:"detail,omitempty"`
+	Adult    bool   `mapstructure:"adult" json:"adult,omitempty"`
+	Disabled bool   `mapstructure:"disabled" json:"disabled,omitempty"` // 停用后不参与搜索和详情查询
+
+	// 对该源主机的限速，为 0 时使用 upstream.sources，多个源共用主机时取较严格的值
+	RateLimit float64 `mapstructure:"rate_limit" json:"rate_limit,omitempty"` // 每秒请求数
+	Burst     int     `mapstructure:"burst" json:"burst,omitempty"`           // 允许的突发请求数
+
+	Proxy string `mapstructure:"proxy" json:"proxy,omitempty"` // 访问该源使用的代理，为空时使用 proxy.default，direct 表示直连
+}
+
+// Webhook 配置
+type Webhook struct {
+	Name       string        `mapstructure:"name" json:"name"`
+	URL        string        `mapstructure:"url" json:"url"`
+	Secret     string        `mapstructure:"secret" json:"-"`
+	Events     []string      `mapstructure:"events" json:"events"` // 为空时订阅全部事件
+	Timeout    time.Duration `mapstructure:"timeout" json:"timeout"`
+	MaxRetries int           `mapstructure:"max_retries" json:"max_retries"`
+}
+
+// Subscribes 是否订阅了指定事件
+func (w Webhook) Subscribes(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event || e == "*" {
+			return true
+		}
+	}
+	return false
 }
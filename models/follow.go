@@ -0,0 +1,44 @@
+package models
+
+import "strconv"
+
+// 收藏 / 追剧
+type Follow struct {
+	SourceKey string `json:"source_key"`
+	VodID     int    `json:"vod_id"`
+	VodName   string `json:"vod_name"` // 源中 ID 失效时按名称重新查找
+	VodPic    string `json:"vod_pic,omitempty"`
+	Follow    bool   `json:"follow"` // true 为追剧（定期检查更新），false 为仅收藏
+
+	// 最近一次检查到的状态
+	EpisodeCount int    `json:"episode_count"`
+	VodRemarks   string `json:"vod_remarks"`
+	VodTime      string `json:"vod_time"`
+
+	CreatedAt int64 `json:"created_at"`
+	CheckedAt int64 `json:"checked_at,omitempty"`
+	UpdatedAt int64 `json:"updated_at,omitempty"` // 最近一次发现更新的时间
+}
+
+// Key 收藏唯一标识
+func (f Follow) Key() string {
+	return f.SourceKey + "|" + strconv.Itoa(f.VodID)
+}
+
+// 追剧更新事件
+type FollowUpdate struct {
+	ID        string `json:"id"`
+	SourceKey string `json:"source_key"`
+	VodID     int    `json:"vod_id"`
+	VodName   string `json:"vod_name"`
+	VodPic    string `json:"vod_pic,omitempty"`
+
+	OldEpisodeCount int    `json:"old_episode_count"`
+	NewEpisodeCount int    `json:"new_episode_count"`
+	OldRemarks      string `json:"old_remarks"`
+	NewRemarks      string `json:"new_remarks"`
+	VodTime         string `json:"vod_time"`
+
+	DetectedAt int64 `json:"detected_at"`
+	Read       bool  `json:"read"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "strconv"
+
+// 播放记录（字段与前端 LocalStorage 中的 PlayHistory 保持一致，便于直接同步）
+type PlayHistory struct {
+	VodID        int     `json:"vod_id"`
+	EpisodeIndex int     `json:"episode_index"`
+	Name         string  `json:"name"`
+	EpisodeTitle string  `json:"episode_title"`
+	SourceKey    string  `json:"sourceKey"`
+	LastPlayTime int64   `json:"lastPlayTime"` // 毫秒时间戳，合并时以此为准
+	Progress     float64 `json:"progress"`     // 播放进度（秒）
+	Duration     float64 `json:"duration"`     // 视频总时长（秒）
+
+	Deleted bool `json:"deleted,omitempty"` // 删除标记，用于同步删除操作
+}
+
+// Key 播放记录唯一标识
+func (h PlayHistory) Key() string {
+	return h.SourceKey + "|" + strconv.Itoa(h.VodID) + "|" + strconv.Itoa(h.EpisodeIndex)
+}
@@ -1,17 +1,65 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
 
 type Episode struct {
 	EpisodeIndex int    `json:"episode_index"`
 	EpisodeTitle string `json:"episode_title"`
 	URL          string `json:"url"`
+
+	// 标题解析结果（无法识别时为空）
+	Number    float64 `json:"number,omitempty"`     // 集数
+	NumberEnd float64 `json:"number_end,omitempty"` // 合集结束集数（如 第1-2集）
+	Part      int     `json:"part,omitempty"`       // 分段（上/中/下、Part N）
+	Season    int     `json:"season,omitempty"`     // 季数提示
+	Special   string  `json:"special,omitempty"`    // 特别篇类型：sp / ova / extra / trailer
+	Label     string  `json:"label,omitempty"`      // 归一化标题
+
+	// 链接检测结果（未检测时为空）
+	Available    *bool  `json:"available,omitempty"`
+	ProbeLatency int64  `json:"probe_latency_ms,omitempty"`
+	ProbeError   string `json:"probe_error,omitempty"`
+}
+
+// 播放线路（vod_play_from / vod_play_url 中以 $$$ 分隔的一组剧集）
+// 搜索结果中只有线路名称，剧集只在详情中返回
+type PlayLine struct {
+	Name     string    `json:"name"`
+	Episodes []Episode `json:"episodes,omitempty"`
+}
+
+// MatchKey 用于跨源匹配同一集的 Key，无法识别集数时返回空字符串
+// 季数只是标题中的提示，不同源写法不一致，因此不参与匹配
+func (e Episode) MatchKey() string {
+	if e.Number <= 0 {
+		return ""
+	}
+	key := "e" + strconv.FormatFloat(e.Number, 'f', -1, 64)
+	if e.NumberEnd > 0 {
+		key += "-" + strconv.FormatFloat(e.NumberEnd, 'f', -1, 64)
+	}
+	if e.Part > 0 {
+		key += fmt.Sprintf("|p%d", e.Part)
+	}
+	if e.Special != "" {
+		key += "|" + e.Special
+	}
+	return key
 }
 
 type VodItem struct {
 	SourceKey  string    `json:"source_key"`
 	SourceName string    `json:"source_name"`
-	Episodes   []Episode `json:"episodes"`
+	Episodes   []Episode `json:"episodes"` // 当前选中线路的剧集
+
+	// 播放线路
+	PlayLine  string     `json:"play_line,omitempty"`
+	PlayLines []PlayLine `json:"play_lines,omitempty"`
 
 	// 基本信息
 	VodID      int         `json:"vod_id"`
@@ -92,6 +140,12 @@ type SearchExtra struct {
 	SuccessCount int    `json:"success_count"`
 	FailedCount  int    `json:"failed_count"`
 	TotalSources int    `json:"total_sources"`
+
+	Stale        bool     `json:"stale,omitempty"`         // 部分视频源使用了过期的缓存结果
+	StaleSources []string `json:"stale_sources,omitempty"` // 使用过期结果的视频源
+
+	Partial        bool     `json:"partial,omitempty"`         // 超过搜索时限，部分视频源未完成
+	PendingSources []string `json:"pending_sources,omitempty"` // 未完成的视频源，结果在后台写入缓存
 }
 
 // ID查询数据结构
@@ -104,4 +158,21 @@ type DetailData struct {
 type DetailExtra struct {
 	SourceKey string `json:"source_key"`
 	VodID     int    `json:"vod_id"`
+
+	PlayLine         string        `json:"play_line,omitempty"`          // 当前播放线路
+	PlayLines        []string      `json:"play_lines,omitempty"`         // 所有播放线路
+	NextEpisodeIndex *int          `json:"next_episode_index,omitempty"` // 下一集，没有时不返回
+	Probe            *ProbeSummary `json:"probe,omitempty"`              // 链接检测结果
+
+	// 缓存已过期、正在后台刷新时返回
+	Stale        bool       `json:"stale,omitempty"`
+	StaleAt      *time.Time `json:"stale_at,omitempty"`
+	RefreshError string     `json:"refresh_error,omitempty"`
+}
+
+// 剧集链接检测统计
+type ProbeSummary struct {
+	Checked int  `json:"checked"`
+	Broken  int  `json:"broken"`
+	Hidden  bool `json:"hidden"` // 是否隐藏了失效的剧集
 }
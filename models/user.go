@@ -0,0 +1,41 @@
+package models
+
+// 用户账号
+type User struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash,omitempty"`
+	Admin        bool      `json:"admin"`
+	Profiles     []Profile `json:"profiles"`
+	CreatedAt    int64     `json:"created_at"`
+}
+
+// 用户下的观看档案（家庭成员），播放记录等数据按档案隔离
+type Profile struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Preferences map[string]string `json:"preferences,omitempty"`
+}
+
+// 登录会话，Token 只保存哈希值
+type Session struct {
+	TokenHash string `json:"token_hash"`
+	UserID    string `json:"user_id"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// Public 返回去除敏感字段的用户信息
+func (u User) Public() User {
+	u.PasswordHash = ""
+	return u
+}
+
+// FindProfile 根据 ID 查找档案
+func (u User) FindProfile(id string) (Profile, bool) {
+	for _, p := range u.Profiles {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
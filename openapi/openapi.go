@@ -0,0 +1,196 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Document OpenAPI 3.0 文档
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Servers    []Server                         `json:"servers,omitempty"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Route 接口说明，Body、Data、Extra 传入对应类型的零值，用于生成 Schema
+type Route struct {
+	Method     string
+	Path       string // gin 路由格式，如 /sources/:key
+	Summary    string
+	Tag        string
+	Security   []string // 需要的认证方式，对应 Spec.Security 注册的名称
+	Query      []Param
+	Body       any     // 请求体
+	BodyFields []Param // 请求体字段的必填项和取值范围，与 CheckBody 使用同一份定义
+	Data       any     // 返回的 data 字段
+	Extra      any     // 返回的 extra 字段
+}
+
+// Spec 文档构建器，所有接口返回同一种外层结构（envelope），data 和 extra 按接口区分
+type Spec struct {
+	doc      Document
+	envelope *Schema
+	names    map[reflect.Type]string
+}
+
+// New 创建文档，server 为接口路径前缀，envelope 为统一返回结构的零值
+func New(info Info, server string, envelope any) *Spec {
+	s := &Spec{
+		doc: Document{
+			OpenAPI:    "3.0.3",
+			Info:       info,
+			Servers:    []Server{{URL: server}},
+			Paths:      map[string]map[string]*Operation{},
+			Components: Components{Schemas: map[string]*Schema{}},
+		},
+		names: map[reflect.Type]string{},
+	}
+	s.envelope = s.schemaOf(reflect.TypeOf(envelope))
+	return s
+}
+
+// Security 注册认证方式
+func (s *Spec) Security(name string, scheme SecurityScheme) {
+	if s.doc.Components.SecuritySchemes == nil {
+		s.doc.Components.SecuritySchemes = map[string]*SecurityScheme{}
+	}
+	s.doc.Components.SecuritySchemes[name] = &scheme
+}
+
+// Add 添加接口
+func (s *Spec) Add(routes ...Route) {
+	for _, r := range routes {
+		path, params := s.pathParams(r.Path)
+		op := &Operation{
+			Summary:    r.Summary,
+			Parameters: params,
+			Responses: map[string]*Response{
+				"200":     s.response("成功", r.Data, r.Extra),
+				"default": {Description: "失败，error_code 为错误类型", Content: jsonContent(s.envelope)},
+			},
+		}
+		if r.Tag != "" {
+			op.Tags = []string{r.Tag}
+		}
+		for _, name := range r.Security {
+			op.Security = append(op.Security, map[string][]string{name: {}})
+		}
+		for _, p := range r.Query {
+			op.Parameters = append(op.Parameters, &Parameter{
+				Name:        p.Name,
+				In:          "query",
+				Description: p.Description,
+				Required:    p.Required,
+				Schema:      p.schema(),
+			})
+		}
+		if r.Body != nil {
+			body := s.schemaOf(reflect.TypeOf(r.Body))
+			if len(r.BodyFields) > 0 {
+				body = &Schema{AllOf: []*Schema{body, objectSchema(r.BodyFields)}}
+			}
+			op.RequestBody = &RequestBody{Required: true, Content: jsonContent(body)}
+		}
+
+		if s.doc.Paths[path] == nil {
+			s.doc.Paths[path] = map[string]*Operation{}
+		}
+		s.doc.Paths[path][strings.ToLower(r.Method)] = op
+	}
+}
+
+// Document 生成的文档
+func (s *Spec) Document() *Document {
+	return &s.doc
+}
+
+// 将 gin 的 :name 路径参数转换为 {name}
+func (s *Spec) pathParams(path string) (string, []*Parameter) {
+	var params []*Parameter
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if name, ok := strings.CutPrefix(part, ":"); ok {
+			parts[i] = "{" + name + "}"
+			params = append(params, &Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: String}})
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+// 成功返回：统一结构中的 data 和 extra 替换为接口对应的类型
+func (s *Spec) response(description string, data, extra any) *Response {
+	if data == nil && extra == nil {
+		return &Response{Description: description, Content: jsonContent(s.envelope)}
+	}
+	override := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	if data != nil {
+		override.Properties["data"] = s.schemaOf(reflect.TypeOf(data))
+	}
+	if extra != nil {
+		override.Properties["extra"] = s.schemaOf(reflect.TypeOf(extra))
+	}
+	return &Response{
+		Description: description,
+		Content:     jsonContent(&Schema{AllOf: []*Schema{s.envelope, override}}),
+	}
+}
+
+func jsonContent(schema *Schema) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: schema}}
+}
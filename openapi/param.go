@@ -0,0 +1,241 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 参数类型
+const (
+	String  = "string"
+	Integer = "integer"
+	Number  = "number"
+	Boolean = "boolean"
+	Array   = "array" // 只用于请求体
+)
+
+// Param 查询参数或请求体字段，同时用于生成文档和校验请求
+type Param struct {
+	Name        string
+	Type        string // String（默认）/ Integer / Number / Boolean / Array
+	Description string
+	Required    bool
+	Default     string
+	Enum        []string // 可选值
+	Min         int      // Integer / Number 的最小值
+	Max         int      // Integer / Number 的最大值、Array 的最大长度，0 表示不限制
+	MaxLength   int      // String 的最大长度（字符数），0 表示不限制
+	Items       []Param  // Array 的元素为对象时各字段的约束
+}
+
+// ParamError 参数校验失败
+type ParamError struct {
+	Name   string
+	Value  string
+	Reason string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("参数 %s %s", e.Name, e.Reason)
+}
+
+// Check 校验参数值，空值视为未传
+func (p Param) Check(value string) error {
+	fail := func(format string, args ...any) error {
+		return &ParamError{Name: p.Name, Value: value, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if strings.TrimSpace(value) == "" {
+		if p.Required {
+			return fail("不能为空")
+		}
+		return nil
+	}
+
+	switch p.Type {
+	case Integer:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fail("必须是整数")
+		}
+		if n < p.Min {
+			return fail("不能小于 %d", p.Min)
+		}
+		if p.Max > 0 && n > p.Max {
+			return fail("不能大于 %d", p.Max)
+		}
+	case Number:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fail("必须是数字")
+		}
+		if n < float64(p.Min) {
+			return fail("不能小于 %d", p.Min)
+		}
+		if p.Max > 0 && n > float64(p.Max) {
+			return fail("不能大于 %d", p.Max)
+		}
+	case Boolean:
+		if value != "true" && value != "false" {
+			return fail("必须是 true 或 false")
+		}
+	default:
+		if p.MaxLength > 0 && utf8.RuneCountInString(value) > p.MaxLength {
+			return fail("长度不能超过 %d", p.MaxLength)
+		}
+	}
+
+	if len(p.Enum) > 0 && !slices.Contains(p.Enum, value) {
+		return fail("必须是以下值之一: %s", strings.Join(p.Enum, ", "))
+	}
+	return nil
+}
+
+// CheckQuery 按顺序校验查询参数，返回第一个错误
+func CheckQuery(values url.Values, params []Param) error {
+	for _, p := range params {
+		if err := p.Check(values.Get(p.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckBody 校验 JSON 请求体，body 必须是对象，按 params 顺序校验字段，返回第一个错误
+// 未列出的字段不校验
+func CheckBody(body []byte, params []Param) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return &ParamError{Name: "body", Reason: "不是有效的 JSON"}
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return &ParamError{Name: "body", Reason: "必须是 JSON 对象"}
+	}
+	return checkObject("", obj, params)
+}
+
+func checkObject(prefix string, obj map[string]any, params []Param) error {
+	for _, p := range params {
+		v := obj[p.Name]
+		if prefix != "" {
+			p.Name = prefix + "." + p.Name
+		}
+		if err := p.checkJSON(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 校验请求体中的字段值：先检查 JSON 类型，再按查询参数的规则校验
+func (p Param) checkJSON(v any) error {
+	fail := func(reason string) error {
+		return &ParamError{Name: p.Name, Value: fmt.Sprint(v), Reason: reason}
+	}
+
+	if v == nil {
+		return p.Check("")
+	}
+	switch p.Type {
+	case Integer, Number:
+		n, ok := v.(json.Number)
+		if !ok {
+			return fail("必须是数字")
+		}
+		return p.Check(n.String())
+	case Boolean:
+		b, ok := v.(bool)
+		if !ok {
+			return fail("必须是 true 或 false")
+		}
+		return p.Check(strconv.FormatBool(b))
+	case Array:
+		list, ok := v.([]any)
+		if !ok {
+			return fail("必须是数组")
+		}
+		if p.Max > 0 && len(list) > p.Max {
+			return fail(fmt.Sprintf("不能超过 %d 项", p.Max))
+		}
+		if len(p.Items) == 0 {
+			return nil
+		}
+		for i, item := range list {
+			obj, ok := item.(map[string]any)
+			if !ok {
+				return &ParamError{Name: fmt.Sprintf("%s[%d]", p.Name, i), Reason: "必须是对象"}
+			}
+			if err := checkObject(fmt.Sprintf("%s[%d]", p.Name, i), obj, p.Items); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		str, ok := v.(string)
+		if !ok {
+			return fail("必须是字符串")
+		}
+		return p.Check(str)
+	}
+}
+
+// 参数对应的 Schema
+func (p Param) schema() *Schema {
+	s := &Schema{Type: p.Type}
+	if s.Type == "" {
+		s.Type = String
+	}
+	for _, v := range p.Enum {
+		s.Enum = append(s.Enum, v)
+	}
+	if p.Default != "" {
+		s.Default = p.Default
+		switch p.Type {
+		case Integer:
+			s.Default, _ = strconv.Atoi(p.Default)
+		case Number:
+			s.Default, _ = strconv.ParseFloat(p.Default, 64)
+		case Boolean:
+			s.Default = p.Default == "true"
+		}
+	}
+	switch s.Type {
+	case Integer, Number:
+		s.Minimum = &p.Min
+		if p.Max > 0 {
+			s.Maximum = &p.Max
+		}
+	case String:
+		s.MaxLength = p.MaxLength
+	case Array:
+		s.MaxItems = p.Max
+		s.Items = &Schema{}
+		if len(p.Items) > 0 {
+			s.Items = objectSchema(p.Items)
+		}
+	}
+	return s
+}
+
+// 请求体字段约束对应的 Schema
+func objectSchema(params []Param) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, p := range params {
+		ps := p.schema()
+		ps.Description = p.Description
+		s.Properties[p.Name] = ps
+		if p.Required {
+			s.Required = append(s.Required, p.Name)
+		}
+	}
+	return s
+}
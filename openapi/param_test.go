@@ -0,0 +1,100 @@
+package openapi
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParamCheck(t *testing.T) {
+	page := Param{Name: "pg", Type: Integer, Min: 1, Max: 100}
+	keyword := Param{Name: "wd", Required: true, MaxLength: 4}
+	adult := Param{Name: "adult", Type: Boolean}
+	sort := Param{Name: "sort", Enum: []string{"time", "rank"}}
+	progress := Param{Name: "progress", Type: Number, Min: 0}
+
+	tests := []struct {
+		name  string
+		param Param
+		value string
+		ok    bool
+	}{
+		{"integer", page, "10", true},
+		{"integer empty", page, "", true},
+		{"integer not number", page, "abc", false},
+		{"integer float", page, "1.5", false},
+		{"integer below min", page, "0", false},
+		{"integer above max", page, "101", false},
+		{"required empty", keyword, "", false},
+		{"required blank", keyword, "  ", false},
+		{"max length in runes", keyword, "权力游戏", true},
+		{"too long", keyword, "权力的游戏", false},
+		{"boolean", adult, "true", true},
+		{"boolean invalid", adult, "1", false},
+		{"enum", sort, "rank", true},
+		{"enum invalid", sort, "name", false},
+		{"number", progress, "12.5", true},
+		{"number negative", progress, "-1", false},
+		{"number invalid", progress, "x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.param.Check(tt.value)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Check(%q) = %v, want ok=%v", tt.value, err, tt.ok)
+			}
+			var paramErr *ParamError
+			if err != nil && (!errors.As(err, &paramErr) || paramErr.Name != tt.param.Name || paramErr.Value != tt.value) {
+				t.Errorf("err = %#v", err)
+			}
+		})
+	}
+}
+
+func TestCheckBody(t *testing.T) {
+	item := []Param{
+		{Name: "key", Required: true, MaxLength: 8},
+		{Name: "id", Type: Integer, Required: true, Min: 1},
+		{Name: "progress", Type: Number, Min: 0},
+		{Name: "follow", Type: Boolean},
+	}
+	params := append([]Param{{Name: "list", Type: Array, Max: 2, Items: item}}, item...)
+
+	tests := []struct {
+		name  string
+		body  string
+		field string // 出错的字段，为空表示通过
+	}{
+		{"valid", `{"key":"a","id":1,"progress":1.5,"follow":true}`, ""},
+		{"unknown fields ignored", `{"key":"a","id":1,"other":[1]}`, ""},
+		{"invalid json", `{"key":`, "body"},
+		{"not object", `[1]`, "body"},
+		{"missing required", `{"id":1}`, "key"},
+		{"null required", `{"key":null,"id":1}`, "key"},
+		{"wrong type string", `{"key":1,"id":1}`, "key"},
+		{"wrong type integer", `{"key":"a","id":"1"}`, "id"},
+		{"integer fraction", `{"key":"a","id":1.5}`, "id"},
+		{"below min", `{"key":"a","id":0}`, "id"},
+		{"negative number", `{"key":"a","id":1,"progress":-1}`, "progress"},
+		{"wrong type boolean", `{"key":"a","id":1,"follow":"true"}`, "follow"},
+		{"array items", `{"key":"a","id":1,"list":[{"key":"b","id":2}]}`, ""},
+		{"array item invalid", `{"key":"a","id":1,"list":[{"key":"b","id":2},{"key":"c"}]}`, "list[1].id"},
+		{"array item not object", `{"key":"a","id":1,"list":[1]}`, "list[0]"},
+		{"array too long", `{"key":"a","id":1,"list":[{},{},{}]}`, "list"},
+		{"not array", `{"key":"a","id":1,"list":{}}`, "list"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckBody([]byte(tt.body), params)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("CheckBody = %v, want nil", err)
+				}
+				return
+			}
+			var paramErr *ParamError
+			if !errors.As(err, &paramErr) || paramErr.Name != tt.field {
+				t.Fatalf("CheckBody = %v, want error on %s", err, tt.field)
+			}
+		})
+	}
+}
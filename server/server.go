@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// Config 服务器参数
+type Config struct {
+	Addr        string
+	BasePath    string // 子路径部署时的路径前缀，如 /tv，为空表示根路径
+	APIPrefix   string // API 路径前缀（位于 BasePath 之后）
+	SPAPath     string // 前端静态文件目录，为空时不提供页面
+	CORSOrigins []string
+	Middlewares []gin.HandlerFunc
+
+	MetricsPath  string            // 指标接口路径（位于 BasePath 之后），为空时不提供
+	Metrics      http.Handler      // 指标接口
+	MetricsGuard []gin.HandlerFunc // 指标接口前执行的中间件，如访问密码
+}
+
+// New 创建 HTTP 服务：API 挂在 BasePath+APIPrefix 下，BasePath 下的其他请求返回前端页面
+func New(cfg Config, registerRoutes func(api *gin.RouterGroup)) *http.Server {
+	r := gin.New()
+	// 指标接口在 Use 之前注册，不经过跨域和限流等中间件，只执行 MetricsGuard
+	if cfg.MetricsPath != "" && cfg.Metrics != nil {
+		handlers := append(append([]gin.HandlerFunc{}, cfg.MetricsGuard...), gin.WrapH(cfg.Metrics))
+		r.GET(cfg.BasePath+cfg.MetricsPath, handlers...)
+	}
+	if len(cfg.CORSOrigins) > 0 {
+		r.Use(corsMiddleware(cfg.CORSOrigins))
+	}
+	r.Use(cfg.Middlewares...)
+
+	apiPath := cfg.BasePath + cfg.APIPrefix
+	registerRoutes(r.Group(apiPath))
+
+	if cfg.SPAPath != "" {
+		if _, err := os.Stat(cfg.SPAPath); err != nil {
+			log.Warn().Str("path", cfg.SPAPath).Msg("前端目录不存在，只提供 API")
+		}
+	}
+	r.NoRoute(func(c *gin.Context) {
+		p := c.Request.URL.Path
+		if cfg.SPAPath == "" || strings.HasPrefix(p, apiPath+"/") || p == apiPath {
+			c.JSON(http.StatusNotFound, gin.H{"code": http.StatusNotFound, "message": "API route not found"})
+			return
+		}
+		// 子路径部署时访问根路径跳转到子路径
+		if cfg.BasePath != "" && (p == "/" || p == cfg.BasePath) {
+			c.Redirect(http.StatusFound, cfg.BasePath+"/")
+			return
+		}
+		rel, ok := strings.CutPrefix(p, cfg.BasePath+"/")
+		if !ok {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		serveSPA(c, cfg.SPAPath, rel)
+	})
+
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// 返回静态文件，文件不存在时返回 index.html，交给前端路由处理
+func serveSPA(c *gin.Context, root, rel string) {
+	name := path.Clean("/" + rel)
+	if f, err := http.Dir(root).Open(name); err == nil {
+		stat, err := f.Stat()
+		f.Close()
+		if err == nil && !stat.IsDir() {
+			c.File(root + name)
+			return
+		}
+	}
+	c.File(root + "/index.html")
+}
+
+func corsMiddleware(origins []string) gin.HandlerFunc {
+	cfg := cors.DefaultConfig()
+	cfg.AllowHeaders = append(cfg.AllowHeaders, "Authorization", "X-Profile-ID", "X-Access-Token")
+	for _, origin := range origins {
+		if origin == "*" {
+			cfg.AllowAllOrigins = true
+			return cors.New(cfg)
+		}
+	}
+	cfg.AllowOrigins = origins
+	cfg.AllowCredentials = true
+	return cors.New(cfg)
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"strconv"
+	"tv/cache"
+	"tv/conf"
+	"tv/models"
+	"tv/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ============ 缓存管理 ============
+
+var cacheTypes = map[string]cache.CacheType{
+	"search": cache.CacheTypeSearch,
+	"id":     cache.CacheTypeID,
+	"hot":    cache.CacheTypeHot,
+}
+
+// 缓存统计
+func CacheStats(c *gin.Context) {
+	Success(c, cache.GetCacher().Stats(), nil)
+}
+
+// 缓存 Key 列表，参数 type 筛选类型，q 按子串搜索
+func ListCacheKeys(c *gin.Context) {
+	var cacheType cache.CacheType
+	if t := c.Query("type"); t != "" {
+		ct, ok := cacheTypes[t]
+		if !ok {
+			Fail(c, validationError("缓存类型错误"), t)
+			return
+		}
+		cacheType = ct
+	}
+
+	keys := cache.GetCacher().Keys(cacheType, c.Query("q"))
+	Success(c, gin.H{"list": keys, "total": len(keys)}, nil)
+}
+
+// 删除单个缓存 Key
+func DeleteCacheKey(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		Fail(c, validationError("key不能为空"), nil)
+		return
+	}
+
+	deleted := cache.GetCacher().Delete(key)
+	Success(c, gin.H{"deleted": deleted}, gin.H{"key": key})
+}
+
+// 清空指定类型的缓存，type 为 all 时清空全部
+func ClearCache(c *gin.Context) {
+	t := c.Param("type")
+	cacher := cache.GetCacher()
+
+	count := 0
+	if t == "all" {
+		count = cacher.Size()
+		cacher.ClearAll()
+	} else {
+		ct, ok := cacheTypes[t]
+		if !ok {
+			Fail(c, validationError("缓存类型错误"), t)
+			return
+		}
+		count = cacher.Clear(ct)
+	}
+
+	webhook.Emit(webhook.EventCacheCleared, gin.H{"type": t, "count": count})
+	Success(c, gin.H{"cleared": count}, gin.H{"type": t})
+}
+
+// 强制刷新关键词搜索缓存，参数与 /search 相同
+func RefreshSearchCache(c *gin.Context) {
+	if !checkQuery(c, searchQuery) {
+		return
+	}
+	keyword := c.Query("wd")
+	page := c.DefaultQuery("pg", "1")
+
+	// 删除各视频源的缓存结果后重新搜索
+	forgetKeyword(keyword, page)
+	data, extra, err := videoAPI.SearchByKeyword(c.Request.Context(), keyword, page, c.DefaultQuery("adult", "false") == "true")
+	if err != nil {
+		Fail(c, err, extra)
+		return
+	}
+
+	log.Info().Str("keyword", keyword).Str("page", page).Msg("强制刷新搜索缓存")
+	Success(c, data, extra)
+}
+
+// 强制刷新 ID 查询缓存，参数与 /vod 相同
+func RefreshIDCache(c *gin.Context) {
+	if !checkQuery(c, refreshVodQuery) {
+		return
+	}
+	sourceKey := c.Query("sourceKey")
+	vodID, _ := strconv.Atoi(c.Query("vodId"))
+	index := c.DefaultQuery("episodeIndex", "0")
+	episodeIndex, _ := strconv.Atoi(index)
+	params := cache.IDParams{SourceKey: sourceKey, VodID: vodID, Index: index}
+
+	data, extra, err := videoAPI.SearchByID(c.Request.Context(), sourceKey, vodID, episodeIndex)
+	if err != nil {
+		Fail(c, err, extra)
+		return
+	}
+	cache.GetCacher().SetByID(params, models.APIResponse{Data: data, Extra: extra})
+
+	log.Info().Str("source_key", sourceKey).Int("vod_id", vodID).Msg("强制刷新 ID 缓存")
+	Success(c, data, extra)
+}
+
+// 强制刷新热门缓存，参数与 /hot 相同
+func RefreshHotCache(c *gin.Context) {
+	if !checkQuery(c, hotQuery) {
+		return
+	}
+	params := hotParams(c)
+
+	data, err := fetchDoubanHot(c.Request.Context(), params)
+	if err != nil {
+		Fail(c, err, nil)
+		return
+	}
+	cache.GetCacher().SetHot(hotCacheKey(params), models.APIResponse{Data: data, Extra: params})
+
+	log.Info().Interface("params", params).Msg("强制刷新热门缓存")
+	Success(c, data, params)
+}
+
+// ============ Webhook 管理 ============
+
+// 已配置的 Webhook（不包含密钥）
+func ListWebhooks(c *gin.Context) {
+	hooks := conf.Get().Webhooks
+	Success(c, gin.H{"list": hooks, "total": len(hooks)}, nil)
+}
+
+// 最近的推送记录
+func ListWebhookDeliveries(c *gin.Context) {
+	list := webhook.GetDispatcher().Deliveries()
+	Success(c, gin.H{"list": list, "total": len(list)}, nil)
+}
+
+// 向指定 Webhook 发送 ping 事件，同步返回推送结果
+func TestWebhook(c *gin.Context) {
+	name := c.Param("name")
+	for _, hook := range conf.Get().Webhooks {
+		if hook.Name != name {
+			continue
+		}
+
+		log.Info().Str("webhook", name).Msg("测试 Webhook")
+		delivery := webhook.GetDispatcher().Send(hook, webhook.EventPing, gin.H{"message": "pong"})
+		Success(c, delivery, nil)
+		return
+	}
+	Fail(c, notFoundError("Webhook 不存在"), name)
+}
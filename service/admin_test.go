@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"tv/cache"
+	"tv/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func adminRouter() *gin.Engine {
+	r := gin.New()
+	admin := r.Group("/api/v1/admin", LoadUser(), RequireAdmin())
+	admin.GET("/cache/keys", ListCacheKeys)
+	admin.DELETE("/cache/key", DeleteCacheKey)
+	admin.DELETE("/cache/:type", ClearCache)
+	admin.POST("/cache/refresh/search", RefreshSearchCache)
+	return r
+}
+
+// 创建用户并登录，返回会话 Token（用户存储在测试间共享，用户名加随机后缀）
+func sessionFor(t *testing.T, username string, admin bool) string {
+	t.Helper()
+	s := GetUserStore()
+	user, err := s.Create(username+"-"+randomID(4), "secret123", admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := s.CreateSession(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func serve(r *gin.Engine, method, target, token string) (int, Response) {
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp Response
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func cachedSearch(name string) func(context.Context) ([]models.VodItem, error) {
+	return func(context.Context) ([]models.VodItem, error) {
+		return []models.VodItem{{SourceKey: "src", VodName: name, Episodes: []models.Episode{{URL: "http://example.com/1.m3u8"}}}}, nil
+	}
+}
+
+func TestAdminCacheRequiresAdmin(t *testing.T) {
+	loadTestConfig(t, "")
+	r := adminRouter()
+
+	if status, _ := serve(r, http.MethodDelete, "/api/v1/admin/cache/all", ""); status != http.StatusUnauthorized {
+		t.Errorf("anonymous = %d, want 401", status)
+	}
+	if status, _ := serve(r, http.MethodDelete, "/api/v1/admin/cache/all", sessionFor(t, "cache-user", false)); status != http.StatusForbidden {
+		t.Errorf("non-admin = %d, want 403", status)
+	}
+}
+
+func TestAdminClearCacheByType(t *testing.T) {
+	loadTestConfig(t, "")
+	r := adminRouter()
+	token := sessionFor(t, "cache-admin", true)
+
+	cacher := cache.GetCacher()
+	cacher.ClearAll()
+	cacher.SetHot(cache.HotParams{Type: "movie"}, models.APIResponse{Data: "hot"})
+	cacher.SetHot(cache.HotParams{Type: "tv"}, models.APIResponse{Data: "hot"})
+	cacher.SetByID(cache.IDParams{SourceKey: "src", VodID: 1, Index: "0"}, models.APIResponse{Data: models.VodItem{VodID: 1}})
+
+	status, resp := serve(r, http.MethodDelete, "/api/v1/admin/cache/hot", token)
+	if status != http.StatusOK || resp.Data.(map[string]any)["cleared"] != float64(2) {
+		t.Fatalf("clear hot = %d %+v", status, resp)
+	}
+	if keys := cacher.Keys("", ""); len(keys) != 1 || keys[0].Type != cache.CacheTypeID {
+		t.Errorf("keys after clearing hot = %+v", keys)
+	}
+
+	if status, resp := serve(r, http.MethodDelete, "/api/v1/admin/cache/bogus", token); status != http.StatusBadRequest || resp.ErrorCode != CodeValidation {
+		t.Errorf("clear bogus = %d %+v", status, resp)
+	}
+
+	status, resp = serve(r, http.MethodDelete, "/api/v1/admin/cache/all", token)
+	if status != http.StatusOK || resp.Data.(map[string]any)["cleared"] != float64(1) || cacher.Size() != 0 {
+		t.Errorf("clear all = %d %+v, size = %d", status, resp, cacher.Size())
+	}
+}
+
+func TestAdminRefreshSearchEvictsKeyword(t *testing.T) {
+	src := newFakeSource(t, "fresh", 0)
+	loadTestConfig(t, sourcesYAML(map[string]*fakeSource{"src": src}))
+	setSearchTTL(t, time.Minute, time.Minute)
+	r := adminRouter()
+	token := sessionFor(t, "refresh-admin", true)
+
+	// 缓存中有错误的结果
+	cacher := cache.GetCacher()
+	poisoned := cache.SearchParams{SourceKey: "src", Keyword: "kw", Page: "1"}
+	other := cache.SearchParams{SourceKey: "src", Keyword: "other", Page: "1"}
+	cacher.FetchSearch(context.Background(), poisoned, cachedSearch("poisoned"))
+	cacher.FetchSearch(context.Background(), other, cachedSearch("other"))
+
+	status, resp := serve(r, http.MethodPost, "/api/v1/admin/cache/refresh/search?wd=kw", token)
+	if status != http.StatusOK {
+		t.Fatalf("refresh = %d %+v", status, resp)
+	}
+	list := resp.Data.(map[string]any)["list"].([]any)
+	if len(list) != 1 || list[0].(map[string]any)["vod_name"] != "fresh" {
+		t.Errorf("refreshed list = %v", list)
+	}
+	if src.calls.Load() != 1 {
+		t.Errorf("source called %d times, want 1", src.calls.Load())
+	}
+	if entry := cacher.FetchSearch(context.Background(), poisoned, cachedSearch("poisoned")); entry.Items[0].VodName != "fresh" {
+		t.Errorf("cached entry = %+v, want the refreshed result", entry)
+	}
+
+	// 其他关键词的缓存不受影响
+	status, resp = serve(r, http.MethodGet, "/api/v1/admin/cache/keys?type=search&q=other", token)
+	if status != http.StatusOK || resp.Data.(map[string]any)["total"] != float64(1) {
+		t.Errorf("keys = %d %+v", status, resp)
+	}
+
+	status, resp = serve(r, http.MethodDelete, "/api/v1/admin/cache/key?key=search|src|other|1", token)
+	if status != http.StatusOK || resp.Data.(map[string]any)["deleted"] != true {
+		t.Errorf("delete key = %d %+v", status, resp)
+	}
+	if status, _ := serve(r, http.MethodDelete, "/api/v1/admin/cache/key", token); status != http.StatusBadRequest {
+		t.Errorf("delete without key = %d, want 400", status)
+	}
+}
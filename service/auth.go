@@ -0,0 +1,386 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"tv/conf"
+	"tv/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	sessionCookie = "ytv_session"
+
+	ctxUserKey    = "user"
+	ctxProfileKey = "profile"
+	ctxTokenKey   = "session_token"
+
+	minPasswordLen = 6
+)
+
+// ============ 中间件 ============
+
+// LoadUser 解析登录信息（Bearer Token 或 Cookie），未登录时直接放行
+// 当前档案由请求头 X-Profile-ID 指定，不属于该用户时使用第一个档案
+func LoadUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := sessionToken(c)
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		user, ok := GetUserStore().LookupSession(token)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		profile, ok := user.FindProfile(c.GetHeader("X-Profile-ID"))
+		if !ok && len(user.Profiles) > 0 {
+			profile = user.Profiles[0]
+		}
+
+		c.Set(ctxUserKey, user)
+		c.Set(ctxProfileKey, profile)
+		c.Set(ctxTokenKey, token)
+		c.Next()
+	}
+}
+
+// RequireUser 要求已登录
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := currentUser(c); !ok {
+			abortWithStatus(c, http.StatusUnauthorized, "请先登录")
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin 要求管理员登录
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c)
+		if !ok {
+			abortWithStatus(c, http.StatusUnauthorized, "请先登录")
+			return
+		}
+		if !user.Admin {
+			abortWithStatus(c, http.StatusForbidden, "需要管理员权限")
+			return
+		}
+		c.Next()
+	}
+}
+
+func currentUser(c *gin.Context) (models.User, bool) {
+	v, ok := c.Get(ctxUserKey)
+	if !ok {
+		return models.User{}, false
+	}
+	user, ok := v.(models.User)
+	return user, ok
+}
+
+func currentProfile(c *gin.Context) (models.Profile, bool) {
+	v, ok := c.Get(ctxProfileKey)
+	if !ok {
+		return models.Profile{}, false
+	}
+	profile, ok := v.(models.Profile)
+	return profile, ok
+}
+
+func sessionToken(c *gin.Context) string {
+	if auth := c.GetHeader("Authorization"); auth != "" {
+		parts := strings.SplitN(auth, " ", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
+			return strings.TrimSpace(parts[1])
+		}
+	}
+	if cookie, err := c.Cookie(sessionCookie); err == nil {
+		return cookie
+	}
+	return ""
+}
+
+func abortWithStatus(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, Response{
+		Code:      status,
+		ErrorCode: codeForStatus(status),
+		Message:   message,
+	})
+}
+
+// 用户存储的错误：已知错误返回对应状态码，其他错误（如保存文件失败）只记录日志
+func userError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrProfileNotFound):
+		abortWithStatus(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrUserExists):
+		abortWithStatus(c, http.StatusConflict, err.Error())
+	case errors.Is(err, errLastAdmin), errors.Is(err, errLastProfile):
+		abortWithStatus(c, http.StatusBadRequest, err.Error())
+	default:
+		Fail(c, err, nil)
+	}
+}
+
+func isSecureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+}
+
+// ============ Handler ============
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type changePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type createUserRequest struct {
+	credentials
+	Admin bool `json:"admin"`
+}
+
+type resetPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+func validateCredentials(cred credentials) error {
+	if !usernameRe.MatchString(cred.Username) {
+		return errors.New("用户名只能包含字母、数字和 _ . -，长度 2-32")
+	}
+	if len(cred.Password) < minPasswordLen {
+		return errors.New("密码长度不能少于 6 位")
+	}
+	return nil
+}
+
+// 注册（需开启 users.allow_register）
+func Register(c *gin.Context) {
+	if !conf.Get().Users.AllowRegister {
+		abortWithStatus(c, http.StatusForbidden, "未开放注册")
+		return
+	}
+
+	var cred credentials
+	if err := c.ShouldBindJSON(&cred); err != nil {
+		Error(c, 400, "请求格式错误", err.Error())
+		return
+	}
+	if err := validateCredentials(cred); err != nil {
+		Error(c, 400, err.Error(), nil)
+		return
+	}
+
+	user, err := GetUserStore().Create(cred.Username, cred.Password, false)
+	if err != nil {
+		userError(c, err)
+		return
+	}
+
+	log.Info().Str("username", user.Username).Msg("用户注册")
+	login(c, user)
+}
+
+// 登录
+func Login(c *gin.Context) {
+	var cred credentials
+	if err := c.ShouldBindJSON(&cred); err != nil {
+		Error(c, 400, "请求格式错误", err.Error())
+		return
+	}
+
+	user, err := GetUserStore().Authenticate(cred.Username, cred.Password)
+	if err != nil {
+		log.Warn().Str("username", cred.Username).Str("ip", c.ClientIP()).Msg("登录失败")
+		abortWithStatus(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	log.Info().Str("username", user.Username).Str("ip", c.ClientIP()).Msg("用户登录")
+	login(c, user)
+}
+
+// 创建会话并写入 Cookie，同时返回 Token 供非浏览器客户端使用
+func login(c *gin.Context, user models.User) {
+	token, expiresAt, err := GetUserStore().CreateSession(user.ID)
+	if err != nil {
+		Error(c, 500, "创建登录会话失败", nil)
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, token, int(time.Until(expiresAt).Seconds()), "/", "", isSecureRequest(c), true)
+
+	Success(c, gin.H{
+		"token":      token,
+		"expires_at": expiresAt.UnixMilli(),
+		"user":       user.Public(),
+	}, nil)
+}
+
+// 注销
+func Logout(c *gin.Context) {
+	if token, ok := c.Get(ctxTokenKey); ok {
+		if err := GetUserStore().DeleteSession(token.(string)); err != nil {
+			Error(c, 500, "注销失败", nil)
+			return
+		}
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, "", -1, "/", "", isSecureRequest(c), true)
+	Success(c, nil, nil)
+}
+
+// 当前登录用户
+func Me(c *gin.Context) {
+	user, _ := currentUser(c)
+	profile, _ := currentProfile(c)
+	Success(c, user.Public(), gin.H{"profile": profile})
+}
+
+// 修改自己的密码
+func ChangePassword(c *gin.Context) {
+	user, _ := currentUser(c)
+
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, 400, "请求格式错误", err.Error())
+		return
+	}
+	if len(req.NewPassword) < minPasswordLen {
+		Error(c, 400, "密码长度不能少于 6 位", nil)
+		return
+	}
+
+	s := GetUserStore()
+	if _, err := s.Authenticate(user.Username, req.OldPassword); err != nil {
+		abortWithStatus(c, http.StatusUnauthorized, "原密码错误")
+		return
+	}
+	if err := s.SetPassword(user.ID, req.NewPassword); err != nil {
+		Error(c, 500, "修改密码失败", nil)
+		return
+	}
+
+	log.Info().Str("username", user.Username).Msg("用户修改密码")
+	login(c, user)
+}
+
+// ============ 管理员 Handler ============
+
+// 用户列表
+func ListUsers(c *gin.Context) {
+	list := GetUserStore().List()
+	Success(c, gin.H{"list": list, "total": len(list)}, nil)
+}
+
+// 创建用户
+func CreateUser(c *gin.Context) {
+	var req createUserRequest
+	if !bindBody(c, createUserBody, &req) {
+		return
+	}
+	if err := validateCredentials(req.credentials); err != nil {
+		Error(c, 400, err.Error(), nil)
+		return
+	}
+
+	user, err := GetUserStore().Create(req.Username, req.Password, req.Admin)
+	if err != nil {
+		userError(c, err)
+		return
+	}
+
+	log.Info().Str("username", user.Username).Bool("admin", user.Admin).Msg("管理员创建用户")
+	Success(c, user.Public(), nil)
+}
+
+// 删除用户
+func DeleteUser(c *gin.Context) {
+	id := c.Param("id")
+	if err := GetUserStore().Delete(id); err != nil {
+		userError(c, err)
+		return
+	}
+
+	log.Info().Str("user_id", id).Msg("管理员删除用户")
+	Success(c, nil, nil)
+}
+
+// 重置用户密码
+func ResetUserPassword(c *gin.Context) {
+	id := c.Param("id")
+
+	var req resetPasswordRequest
+	if !bindBody(c, resetPasswordBody, &req) {
+		return
+	}
+	if len(req.Password) < minPasswordLen {
+		Error(c, 400, "密码长度不能少于 6 位", nil)
+		return
+	}
+
+	if err := GetUserStore().SetPassword(id, req.Password); err != nil {
+		userError(c, err)
+		return
+	}
+
+	log.Info().Str("user_id", id).Msg("管理员重置用户密码")
+	Success(c, nil, nil)
+}
+
+// ============ 档案 Handler ============
+
+// 当前用户的档案列表
+func ListProfiles(c *gin.Context) {
+	user, _ := currentUser(c)
+	Success(c, gin.H{"list": user.Profiles, "total": len(user.Profiles)}, nil)
+}
+
+// 新增档案（POST）或更新档案（PUT /:id）
+func SaveProfile(c *gin.Context) {
+	user, _ := currentUser(c)
+
+	var p models.Profile
+	if err := c.ShouldBindJSON(&p); err != nil {
+		Error(c, 400, "请求格式错误", err.Error())
+		return
+	}
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		Error(c, 400, "档案名称不能为空", nil)
+		return
+	}
+	p.ID = c.Param("id")
+
+	saved, err := GetUserStore().SaveProfile(user.ID, p)
+	if err != nil {
+		userError(c, err)
+		return
+	}
+	Success(c, saved, nil)
+}
+
+// 删除档案
+func DeleteProfile(c *gin.Context) {
+	user, _ := currentUser(c)
+	if err := GetUserStore().DeleteProfile(user.ID, c.Param("id")); err != nil {
+		userError(c, err)
+		return
+	}
+	Success(c, nil, nil)
+}
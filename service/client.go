@@ -1,7 +1,10 @@
 package service
 
 import (
+	"context"
+	"net/http"
 	"time"
+	"tv/upstream"
 
 	"github.com/go-resty/resty/v2"
 )
@@ -10,10 +13,12 @@ type Client struct {
 	resty *resty.Client
 }
 
+// NewClient 访问上游的客户端，请求按主机限速，并按配置走代理
 func NewClient(baseURL string, timeout time.Duration, defaultHeaders map[string]string) *Client {
 	c := resty.New().
 		SetBaseURL(baseURL).
 		SetTimeout(timeout)
+	c.SetTransport(upstream.Transport())
 
 	// 设置默认 Header
 	for k, v := range defaultHeaders {
@@ -24,3 +29,13 @@ func NewClient(baseURL string, timeout time.Duration, defaultHeaders map[string]
 		resty: c,
 	}
 }
+
+// colly v1 不支持 Context，通过 Transport 为每个请求附加 ctx，请求取消时中止抓取
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
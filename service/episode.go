@@ -0,0 +1,262 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"tv/models"
+)
+
+var (
+	// 第2季 / S02 / S2E05
+	seasonRe = regexp.MustCompile(`(?i)第\s*([0-9零一二三四五六七八九十两]+)\s*季|(?:^|[^A-Z])S(\d{1,2})(?:\s*E\d+|[^A-Z0-9]|$)`)
+	// 第1-2集 / 第01~03话
+	rangeRe = regexp.MustCompile(`第\s*(\d+)\s*[-~～至到]\s*(\d+)\s*[集话話回期]`)
+	// 第01集 / 第十二话 / 第20240101期
+	cnNumberRe = regexp.MustCompile(`第\s*([0-9]+(?:\.[0-9]+)?|[零一二三四五六七八九十百两]+)\s*[集话話回期]`)
+	// EP01 / E05 / Episode 3 / S01E02
+	enNumberRe = regexp.MustCompile(`(?i)(?:^|[^A-Z])(?:EPISODE|EP|E)\s*\.?\s*(\d+(?:\.\d+)?)`)
+	// 01 / 12(完结) / 03集
+	leadingNumberRe = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*(?:[集话話回期]|$|[\s_\-(（\[【])`)
+
+	// 第1集上 / 第3集(下) / （中）
+	cnPartRe = regexp.MustCompile(`(?:[集话話回期]\s*[(（]?|[(（])([上中下])[)）]?`)
+	enPartRe = regexp.MustCompile(`(?i)\bPART\s*(\d+)`)
+
+	ovaRe     = regexp.MustCompile(`(?i)(?:^|[^A-Z])(?:OVA|OAD)(?:[^A-Z]|$)`)
+	spRe      = regexp.MustCompile(`(?i)(?:^|[^A-Z])SP(?:[^A-Z]|$)|特别篇|特別篇|特辑|特輯`)
+	extraRe   = regexp.MustCompile(`番外|花絮|彩蛋|幕后|幕後`)
+	trailerRe = regexp.MustCompile(`(?i)预告|預告|先导|先導|(?:^|[^A-Z])PV(?:[^A-Z]|$)`)
+)
+
+var cnParts = map[string]int{"上": 1, "中": 2, "下": 3}
+
+var cnDigits = map[rune]int{
+	'零': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4,
+	'五': 5, '六': 6, '七': 7, '八': 8, '九': 9,
+}
+
+// 解析剧集标题，填充集数、分段、季数、特别篇标记和归一化标题
+func parseEpisodeTitle(ep *models.Episode) {
+	title := strings.TrimSpace(ep.EpisodeTitle)
+	if title == "" {
+		return
+	}
+
+	if m := seasonRe.FindStringSubmatch(title); m != nil {
+		if m[1] != "" {
+			ep.Season = parseNumber(m[1])
+		} else {
+			ep.Season, _ = strconv.Atoi(m[2])
+		}
+	}
+
+	switch {
+	case ovaRe.MatchString(title):
+		ep.Special = "ova"
+	case spRe.MatchString(title):
+		ep.Special = "sp"
+	case extraRe.MatchString(title):
+		ep.Special = "extra"
+	case trailerRe.MatchString(title):
+		ep.Special = "trailer"
+	}
+
+	if m := rangeRe.FindStringSubmatch(title); m != nil {
+		ep.Number, _ = strconv.ParseFloat(m[1], 64)
+		ep.NumberEnd, _ = strconv.ParseFloat(m[2], 64)
+	} else if m := cnNumberRe.FindStringSubmatch(title); m != nil {
+		ep.Number = parseFloat(m[1])
+	} else if m := enNumberRe.FindStringSubmatch(title); m != nil {
+		ep.Number, _ = strconv.ParseFloat(m[1], 64)
+	} else if m := leadingNumberRe.FindStringSubmatch(title); m != nil {
+		ep.Number, _ = strconv.ParseFloat(m[1], 64)
+	}
+
+	if m := cnPartRe.FindStringSubmatch(title); m != nil {
+		ep.Part = cnParts[m[1]]
+	} else if m := enPartRe.FindStringSubmatch(title); m != nil {
+		ep.Part, _ = strconv.Atoi(m[1])
+	}
+
+	ep.Label = episodeLabel(*ep, title)
+}
+
+// 生成归一化标题，无法识别集数时保留原标题
+func episodeLabel(ep models.Episode, title string) string {
+	if ep.Number <= 0 || ep.Special != "" {
+		return title
+	}
+
+	// 综艺按期数编号
+	unit := "集"
+	if strings.Contains(title, "期") {
+		unit = "期"
+	}
+
+	label := "第" + formatNumber(ep.Number) + unit
+	if ep.NumberEnd > 0 {
+		label = "第" + formatNumber(ep.Number) + "-" + formatNumber(ep.NumberEnd) + unit
+	}
+	if ep.Part > 0 && ep.Part <= 3 && cnPartRe.MatchString(title) {
+		label += []string{"上", "中", "下"}[ep.Part-1]
+	} else if ep.Part > 0 {
+		label += fmt.Sprintf(" Part %d", ep.Part)
+	}
+	return label
+}
+
+// 解析标题并按集数排序
+// 倒序列表先整体反转；之后只在正片所在位置之间重新排序，特别篇和无法识别的剧集保持原位置
+// EpisodeIndex 保留源中的原始位置，不随排序变化
+func normalizeEpisodes(episodes []models.Episode) []models.Episode {
+	for i := range episodes {
+		parseEpisodeTitle(&episodes[i])
+	}
+
+	if isReversed(episodes) {
+		for i, j := 0, len(episodes)-1; i < j; i, j = i+1, j-1 {
+			episodes[i], episodes[j] = episodes[j], episodes[i]
+		}
+	}
+
+	slots := make([]int, 0, len(episodes))
+	numbered := make([]models.Episode, 0, len(episodes))
+	for i, ep := range episodes {
+		if isRegularEpisode(ep) {
+			slots = append(slots, i)
+			numbered = append(numbered, ep)
+		}
+	}
+
+	sort.SliceStable(numbered, func(i, j int) bool {
+		a, b := numbered[i], numbered[j]
+		if a.Season != b.Season {
+			return a.Season < b.Season
+		}
+		if a.Number != b.Number {
+			return a.Number < b.Number
+		}
+		return a.Part < b.Part
+	})
+
+	for i, slot := range slots {
+		episodes[slot] = numbered[i]
+	}
+	return episodes
+}
+
+// 相邻正片中递减多于递增时认为列表是倒序的
+func isReversed(episodes []models.Episode) bool {
+	asc, desc := 0, 0
+	var prev *models.Episode
+	for i := range episodes {
+		ep := &episodes[i]
+		if !isRegularEpisode(*ep) {
+			continue
+		}
+		if prev != nil {
+			switch {
+			case ep.Number > prev.Number:
+				asc++
+			case ep.Number < prev.Number:
+				desc++
+			}
+		}
+		prev = ep
+	}
+	return desc > asc
+}
+
+func isRegularEpisode(ep models.Episode) bool {
+	return ep.Number > 0 && ep.Special == ""
+}
+
+// nextEpisode 返回当前剧集（按 EpisodeIndex 查找）之后的下一集，跳过与当前集相同的重复项
+func nextEpisode(episodes []models.Episode, index int) (models.Episode, bool) {
+	pos := -1
+	for i, ep := range episodes {
+		if ep.EpisodeIndex == index {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return models.Episode{}, false
+	}
+
+	current := episodes[pos].MatchKey()
+	for _, ep := range episodes[pos+1:] {
+		if current != "" && ep.MatchKey() == current {
+			continue
+		}
+		return ep, true
+	}
+	return models.Episode{}, false
+}
+
+// ============ Handler 辅助 ============
+
+// 在 extra 中返回下一集的 EpisodeIndex，没有下一集时不设置
+func attachNextEpisode(data any, extra any, index int) (any, any) {
+	item, ok := data.(models.VodItem)
+	if !ok {
+		return data, extra
+	}
+
+	next, ok := nextEpisode(item.Episodes, index)
+	if !ok {
+		return data, extra
+	}
+
+	newExtra := copyExtra(extra)
+	newExtra["next_episode_index"] = next.EpisodeIndex
+	return data, newExtra
+}
+
+// ====== 工具函数 =======
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func parseFloat(s string) float64 {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return float64(parseNumber(s))
+}
+
+// 解析阿拉伯数字或中文数字（支持到九百九十九）
+func parseNumber(s string) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+
+	total, current := 0, 0
+	for _, r := range s {
+		switch r {
+		case '百':
+			if current == 0 {
+				current = 1
+			}
+			total += current * 100
+			current = 0
+		case '十':
+			if current == 0 {
+				current = 1
+			}
+			total += current * 10
+			current = 0
+		default:
+			d, ok := cnDigits[r]
+			if !ok {
+				return 0
+			}
+			current = d
+		}
+	}
+	return total + current
+}
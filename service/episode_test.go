@@ -0,0 +1,100 @@
+package service
+
+import (
+	"testing"
+	"tv/models"
+)
+
+func TestParseEpisodeTitle(t *testing.T) {
+	tests := []struct {
+		title   string
+		number  float64
+		end     float64
+		part    int
+		season  int
+		special string
+		label   string
+	}{
+		{title: "第01集", number: 1, label: "第1集"},
+		{title: "EP1", number: 1, label: "第1集"},
+		{title: "HD中字", label: "HD中字"},
+		{title: "正片", label: "正片"},
+		{title: "第1-2集", number: 1, end: 2, label: "第1-2集"},
+		{title: "第十二话", number: 12, label: "第12集"},
+		{title: "12(完结)", number: 12, label: "第12集"},
+		{title: "第3集上", number: 3, part: 1, label: "第3集上"},
+		{title: "S02E05", number: 5, season: 2, label: "第5集"},
+		{title: "第2季 第07集", number: 7, season: 2, label: "第7集"},
+		{title: "第20240101期", number: 20240101, label: "第20240101期"},
+		{title: "OVA", special: "ova", label: "OVA"},
+		{title: "SP1", special: "sp", label: "SP1"},
+		{title: "花絮", special: "extra", label: "花絮"},
+		{title: "预告", special: "trailer", label: "预告"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			ep := models.Episode{EpisodeTitle: tt.title}
+			parseEpisodeTitle(&ep)
+			if ep.Number != tt.number || ep.NumberEnd != tt.end || ep.Part != tt.part ||
+				ep.Season != tt.season || ep.Special != tt.special || ep.Label != tt.label {
+				t.Errorf("got number=%v end=%v part=%d season=%d special=%q label=%q",
+					ep.Number, ep.NumberEnd, ep.Part, ep.Season, ep.Special, ep.Label)
+			}
+		})
+	}
+}
+
+func episodesOf(titles ...string) []models.Episode {
+	episodes := make([]models.Episode, len(titles))
+	for i, title := range titles {
+		episodes[i] = models.Episode{EpisodeIndex: i, EpisodeTitle: title}
+		parseEpisodeTitle(&episodes[i])
+	}
+	return episodes
+}
+
+func TestIsReversed(t *testing.T) {
+	tests := []struct {
+		name   string
+		titles []string
+		want   bool
+	}{
+		{"ascending", []string{"第01集", "第02集", "第03集"}, false},
+		{"descending", []string{"第03集", "第02集", "第01集"}, true},
+		{"descending with specials", []string{"预告", "EP3", "EP2", "HD中字", "EP1"}, true},
+		{"mostly ascending", []string{"第1集", "第3集", "第2集", "第4集"}, false},
+		{"single", []string{"正片"}, false},
+		{"unnumbered", []string{"HD中字", "正片"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isReversed(episodesOf(tt.titles...)); got != tt.want {
+				t.Errorf("isReversed(%q) = %v, want %v", tt.titles, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeEpisodes(t *testing.T) {
+	episodes := normalizeEpisodes(episodesOf("第03集", "花絮", "第02集", "第01集"))
+
+	var titles []string
+	var indexes []int
+	for _, ep := range episodes {
+		titles = append(titles, ep.EpisodeTitle)
+		indexes = append(indexes, ep.EpisodeIndex)
+	}
+	// 反转后正片按集数排序，花絮保持反转后的位置，EpisodeIndex 不变
+	wantTitles := []string{"第01集", "第02集", "花絮", "第03集"}
+	wantIndexes := []int{3, 2, 1, 0}
+	for i := range wantTitles {
+		if titles[i] != wantTitles[i] || indexes[i] != wantIndexes[i] {
+			t.Fatalf("got titles=%q indexes=%v, want titles=%q indexes=%v", titles, indexes, wantTitles, wantIndexes)
+		}
+	}
+
+	next, ok := nextEpisode(episodes, 2)
+	if !ok || next.EpisodeIndex != 1 {
+		t.Errorf("nextEpisode after index 2 = %+v, %v, want index 1", next, ok)
+	}
+}
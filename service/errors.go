@@ -0,0 +1,120 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"tv/upstream"
+)
+
+// ErrorCode 稳定的错误码，客户端应根据 error_code 而不是 message 判断错误类型
+type ErrorCode string
+
+const (
+	CodeValidation          ErrorCode = "validation_failed"     // 请求参数错误
+	CodeUnauthorized        ErrorCode = "unauthorized"          // 未登录或密码错误
+	CodeForbidden           ErrorCode = "forbidden"             // 没有权限
+	CodeNotFound            ErrorCode = "not_found"             // 资源不存在
+	CodeConflict            ErrorCode = "conflict"              // 资源已存在
+	CodeRateLimited         ErrorCode = "rate_limited"          // 请求过于频繁（本服务或上游限流）
+	CodeUpstreamUnavailable ErrorCode = "upstream_unavailable"  // 视频源、Omo 或豆瓣无法访问
+	CodeUpstreamParse       ErrorCode = "upstream_bad_response" // 上游返回的内容无法解析
+	CodeInternal            ErrorCode = "internal_error"        // 其他错误
+)
+
+var codeStatus = map[ErrorCode]int{
+	CodeValidation:          http.StatusBadRequest,
+	CodeUnauthorized:        http.StatusUnauthorized,
+	CodeForbidden:           http.StatusForbidden,
+	CodeNotFound:            http.StatusNotFound,
+	CodeConflict:            http.StatusConflict,
+	CodeRateLimited:         http.StatusTooManyRequests,
+	CodeUpstreamUnavailable: http.StatusBadGateway,
+	CodeUpstreamParse:       http.StatusBadGateway,
+	CodeInternal:            http.StatusInternalServerError,
+}
+
+// 按 HTTP 状态码推断错误码，用于只给出状态码的 Error 和 abortWithStatus
+func codeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeValidation
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway:
+		return CodeUpstreamUnavailable
+	default:
+		return CodeInternal
+	}
+}
+
+// APIError 带错误类型的错误，Fail 根据类型返回对应的 HTTP 状态码
+type APIError struct {
+	Code    ErrorCode
+	Message string // 返回给客户端的说明
+	Err     error  // 原始错误，只记录在日志中，不返回给客户端
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+// ClientMessage 返回给客户端的说明，不包含原始错误
+func (e *APIError) ClientMessage() string {
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Status 对应的 HTTP 状态码
+func (e *APIError) Status() int {
+	if status, ok := codeStatus[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+func newError(code ErrorCode, err error, format string, args ...any) *APIError {
+	return &APIError{Code: code, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+func validationError(format string, args ...any) *APIError {
+	return newError(CodeValidation, nil, format, args...)
+}
+
+func notFoundError(format string, args ...any) *APIError {
+	return newError(CodeNotFound, nil, format, args...)
+}
+
+// 上游无法访问（网络错误、超时、非 2xx 状态码），本地限速排队超时视为限流
+func upstreamError(err error, format string, args ...any) *APIError {
+	if upstream.IsLimited(err) {
+		return newError(CodeRateLimited, err, format, args...)
+	}
+	return newError(CodeUpstreamUnavailable, err, format, args...)
+}
+
+// 上游返回的内容无法解析
+func upstreamParseError(err error, format string, args ...any) *APIError {
+	return newError(CodeUpstreamParse, err, format, args...)
+}
+
+// 上游返回错误状态码，429 视为限流
+func upstreamStatusError(status int) *APIError {
+	if status == http.StatusTooManyRequests {
+		return newError(CodeRateLimited, nil, "上游请求过于频繁（HTTP %d）", status)
+	}
+	return upstreamError(nil, "HTTP 状态码 %d", status)
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFailHidesCause(t *testing.T) {
+	cause := errors.New("dial tcp 10.0.0.1:80: connection refused")
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    ErrorCode
+		message string
+	}{
+		{"upstream", upstreamError(cause, "请求视频源失败"), http.StatusBadGateway, CodeUpstreamUnavailable, "请求视频源失败"},
+		{"wrapped", fmt.Errorf("详情: %w", upstreamParseError(cause, "解析 JSON 失败")), http.StatusBadGateway, CodeUpstreamParse, "解析 JSON 失败"},
+		{"plain", cause, http.StatusInternalServerError, CodeInternal, "服务器内部错误"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/", nil)
+
+			Fail(c, tt.err, nil)
+
+			var resp Response
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.status || resp.ErrorCode != tt.code || resp.Message != tt.message {
+				t.Errorf("got status=%d code=%s message=%q", w.Code, resp.ErrorCode, resp.Message)
+			}
+			if strings.Contains(w.Body.String(), "10.0.0.1") {
+				t.Errorf("响应包含原始错误: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func callHandler(handler gin.HandlerFunc, body string, params ...gin.Param) (*httptest.ResponseRecorder, Response) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+
+	handler(c)
+
+	var resp Response
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func TestUserErrors(t *testing.T) {
+	loadTestConfig(t, "")
+
+	username := "conflict-" + randomID(4)
+	body := `{"username":"` + username + `","password":"secret123"}`
+	if w, _ := callHandler(CreateUser, body); w.Code != http.StatusOK {
+		t.Fatalf("CreateUser = %d", w.Code)
+	}
+
+	missing := gin.Param{Key: "id", Value: "missing"}
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		body    string
+		params  []gin.Param
+		status  int
+		code    ErrorCode
+	}{
+		{"duplicate", CreateUser, body, nil, http.StatusConflict, CodeConflict},
+		{"duplicate ignores case", CreateUser, `{"username":"` + strings.ToUpper(username) + `","password":"secret123"}`, nil, http.StatusConflict, CodeConflict},
+		{"delete missing", DeleteUser, "", []gin.Param{missing}, http.StatusNotFound, CodeNotFound},
+		{"reset missing", ResetUserPassword, `{"password":"secret123"}`, []gin.Param{missing}, http.StatusNotFound, CodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, resp := callHandler(tt.handler, tt.body, tt.params...)
+			if w.Code != tt.status || resp.ErrorCode != tt.code {
+				t.Errorf("got status=%d code=%s message=%q", w.Code, resp.ErrorCode, resp.Message)
+			}
+		})
+	}
+}
+
+func TestStoreErrorsHidePaths(t *testing.T) {
+	cause := &os.PathError{Op: "open", Path: "/srv/ytv/data/users.json", Err: os.ErrPermission}
+	for name, fn := range map[string]func(*gin.Context, error){"user": userError, "source": sourceError} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", nil)
+
+		fn(c, cause)
+
+		var resp Response
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusInternalServerError || resp.ErrorCode != CodeInternal {
+			t.Errorf("%s: got status=%d code=%s", name, w.Code, resp.ErrorCode)
+		}
+		if strings.Contains(w.Body.String(), "/srv/ytv") {
+			t.Errorf("%s: 响应包含服务器路径: %s", name, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,525 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tv/conf"
+	"tv/models"
+	"tv/store"
+	"tv/tracing"
+	"tv/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	followStore *FollowStore
+	followOnce  sync.Once
+)
+
+func GetFollowStore() *FollowStore {
+	followOnce.Do(func() {
+		followStore = &FollowStore{
+			path:        filepath.Join(conf.Get().App.DataDir, "follows.json"),
+			updatesPath: filepath.Join(conf.Get().App.DataDir, "follow_updates.json"),
+			follows:     make(map[string]map[string]models.Follow),
+			updates:     make(map[string][]models.FollowUpdate),
+		}
+		if err := store.LoadJSON(followStore.path, &followStore.follows); err != nil {
+			log.Error().Err(err).Str("path", followStore.path).Msg("加载收藏失败")
+		}
+		if err := store.LoadJSON(followStore.updatesPath, &followStore.updates); err != nil {
+			log.Error().Err(err).Str("path", followStore.updatesPath).Msg("加载追剧更新失败")
+		}
+
+		log.Info().
+			Int("profiles", len(followStore.follows)).
+			Msg("收藏存储已就绪")
+	})
+	return followStore
+}
+
+// FollowStore 按用户保存收藏 / 追剧和更新事件
+type FollowStore struct {
+	sync.RWMutex
+	path        string
+	updatesPath string
+	follows     map[string]map[string]models.Follow // profile -> key -> follow
+	updates     map[string][]models.FollowUpdate    // profile -> 更新事件（最新在前）
+}
+
+// 检查时获取到的视频状态
+type followSnapshot struct {
+	VodID        int
+	VodName      string
+	VodPic       string
+	EpisodeCount int
+	VodRemarks   string
+	VodTime      string
+}
+
+// List 按添加时间倒序返回收藏
+func (s *FollowStore) List(profile string) []models.Follow {
+	s.RLock()
+	defer s.RUnlock()
+
+	list := make([]models.Follow, 0, len(s.follows[profile]))
+	for _, f := range s.follows[profile] {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt > list[j].CreatedAt
+	})
+	return list
+}
+
+// Save 新增或更新收藏（已存在时保留检查状态）
+func (s *FollowStore) Save(profile string, f models.Follow) (models.Follow, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	items := s.follows[profile]
+	if items == nil {
+		items = make(map[string]models.Follow)
+		s.follows[profile] = items
+	}
+
+	if old, ok := items[f.Key()]; ok {
+		old.Follow = f.Follow
+		if f.VodName != "" {
+			old.VodName = f.VodName
+		}
+		if f.VodPic != "" {
+			old.VodPic = f.VodPic
+		}
+		f = old
+	}
+	items[f.Key()] = f
+
+	return f, s.saveFollows()
+}
+
+// Remove 删除收藏
+func (s *FollowStore) Remove(profile, sourceKey string, vodID int) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	key := models.Follow{SourceKey: sourceKey, VodID: vodID}.Key()
+	if _, ok := s.follows[profile][key]; !ok {
+		return false, nil
+	}
+	delete(s.follows[profile], key)
+	return true, s.saveFollows()
+}
+
+// Updates 返回更新事件
+func (s *FollowStore) Updates(profile string, unreadOnly bool) []models.FollowUpdate {
+	s.RLock()
+	defer s.RUnlock()
+
+	list := make([]models.FollowUpdate, 0, len(s.updates[profile]))
+	for _, u := range s.updates[profile] {
+		if unreadOnly && u.Read {
+			continue
+		}
+		list = append(list, u)
+	}
+	return list
+}
+
+// MarkRead 将更新事件标记为已读，ids 为空时标记全部
+func (s *FollowStore) MarkRead(profile string, ids []string) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+
+	count := 0
+	for i, u := range s.updates[profile] {
+		if u.Read || (len(ids) > 0 && !want[u.ID]) {
+			continue
+		}
+		s.updates[profile][i].Read = true
+		count++
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+	return count, s.saveUpdates()
+}
+
+// 返回所有用户追剧的条目（相同视频只返回一次）
+func (s *FollowStore) followed() []models.Follow {
+	s.RLock()
+	defer s.RUnlock()
+
+	seen := make(map[string]bool)
+	list := make([]models.Follow, 0)
+	for _, items := range s.follows {
+		for key, f := range items {
+			if !f.Follow || seen[key] {
+				continue
+			}
+			seen[key] = true
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+// 将检查结果应用到所有追剧该视频的用户，返回新产生的更新事件
+// 集数增加，或备注和更新时间同时变化时视为有新剧集；首次检查只记录状态
+func (s *FollowStore) apply(old models.Follow, snap followSnapshot) []models.FollowUpdate {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now().UnixMilli()
+	oldKey := old.Key()
+	created := make([]models.FollowUpdate, 0)
+
+	for profile, items := range s.follows {
+		f, ok := items[oldKey]
+		if !ok {
+			continue
+		}
+
+		hasUpdate := f.CheckedAt != 0 &&
+			(snap.EpisodeCount > f.EpisodeCount ||
+				(snap.VodRemarks != f.VodRemarks && snap.VodTime != f.VodTime))
+
+		if hasUpdate && f.Follow {
+			u := models.FollowUpdate{
+				ID:              randomID(8),
+				SourceKey:       f.SourceKey,
+				VodID:           snap.VodID,
+				VodName:         snap.VodName,
+				VodPic:          snap.VodPic,
+				OldEpisodeCount: f.EpisodeCount,
+				NewEpisodeCount: snap.EpisodeCount,
+				OldRemarks:      f.VodRemarks,
+				NewRemarks:      snap.VodRemarks,
+				VodTime:         snap.VodTime,
+				DetectedAt:      now,
+			}
+			s.updates[profile] = append([]models.FollowUpdate{u}, s.updates[profile]...)
+			if max := conf.Get().Follows.MaxUpdates; max > 0 && len(s.updates[profile]) > max {
+				s.updates[profile] = s.updates[profile][:max]
+			}
+			created = append(created, u)
+			f.UpdatedAt = now
+		}
+
+		f.VodID = snap.VodID
+		f.VodName = snap.VodName
+		if snap.VodPic != "" {
+			f.VodPic = snap.VodPic
+		}
+		f.EpisodeCount = snap.EpisodeCount
+		f.VodRemarks = snap.VodRemarks
+		f.VodTime = snap.VodTime
+		f.CheckedAt = now
+
+		// 按名称重新找到的视频 ID 可能变化，新 ID 已在收藏中时合并为一条
+		delete(items, oldKey)
+		if existing, ok := items[f.Key()]; ok && f.Key() != oldKey {
+			f = mergeFollow(existing, f)
+		}
+		items[f.Key()] = f
+	}
+
+	if err := s.saveFollows(); err != nil {
+		return created
+	}
+	if len(created) > 0 {
+		s.saveUpdates()
+	}
+	return created
+}
+
+// 合并同一视频的两条收藏：状态取刚检查过的 moved，任一条追剧即为追剧，保留最早的添加时间
+func mergeFollow(existing, moved models.Follow) models.Follow {
+	merged := moved
+	merged.Follow = existing.Follow || moved.Follow
+	merged.CreatedAt = min(existing.CreatedAt, moved.CreatedAt)
+	merged.UpdatedAt = max(existing.UpdatedAt, moved.UpdatedAt)
+	return merged
+}
+
+func (s *FollowStore) saveFollows() error {
+	if err := store.SaveJSON(s.path, s.follows); err != nil {
+		log.Error().Err(err).Str("path", s.path).Msg("保存收藏失败")
+		return err
+	}
+	return nil
+}
+
+func (s *FollowStore) saveUpdates() error {
+	if err := store.SaveJSON(s.updatesPath, s.updates); err != nil {
+		log.Error().Err(err).Str("path", s.updatesPath).Msg("保存追剧更新失败")
+		return err
+	}
+	return nil
+}
+
+// ============ 更新检查 ============
+
+// StartFollowChecker 启动定期检查追剧更新的协程，启动后立即检查一次，ctx 取消时退出
+func StartFollowChecker(ctx context.Context) {
+	interval := conf.Get().Follows.CheckInterval
+	if interval <= 0 {
+		log.Info().Msg("追剧更新检查已关闭")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		log.Info().Dur("interval", interval).Msg("追剧更新检查协程已启动")
+
+		for {
+			CheckFollows(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// CheckFollows 逐个重新获取追剧条目并记录更新，返回新产生的更新事件数量
+func CheckFollows(ctx context.Context) int {
+	ctx, span := tracing.Start(ctx, "follows.check")
+	defer span.End()
+
+	start := time.Now()
+	s := GetFollowStore()
+	followed := s.followed()
+
+	total := 0
+	failed := 0
+	for i, f := range followed {
+		// 逐个请求，避免对源站造成压力
+		if i > 0 {
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			log.Info().Ctx(ctx).Int("checked", i).Int("followed", len(followed)).Msg("服务退出，停止检查追剧更新")
+			return total
+		}
+
+		snap, err := fetchFollowSnapshot(ctx, f)
+		if err != nil {
+			failed++
+			log.Warn().Ctx(ctx).
+				Str("source_key", f.SourceKey).
+				Int("vod_id", f.VodID).
+				Str("vod_name", f.VodName).
+				Err(err).
+				Msg("检查追剧更新失败")
+			continue
+		}
+
+		updates := s.apply(f, snap)
+		for _, u := range updates {
+			log.Info().Ctx(ctx).
+				Str("source_key", u.SourceKey).
+				Int("vod_id", u.VodID).
+				Str("vod_name", u.VodName).
+				Int("old_episodes", u.OldEpisodeCount).
+				Int("new_episodes", u.NewEpisodeCount).
+				Str("remarks", u.NewRemarks).
+				Msg("发现追剧更新")
+		}
+		// 同一视频被多个用户追剧时只推送一次
+		if len(updates) > 0 {
+			webhook.Emit(webhook.EventFollowUpdate, updates[0])
+		}
+		total += len(updates)
+	}
+
+	log.Info().Ctx(ctx).
+		Int("followed", len(followed)).
+		Int("failed", failed).
+		Int("updates", total).
+		Int64("duration_ms", time.Since(start).Milliseconds()).
+		Msg("追剧更新检查完成")
+
+	return total
+}
+
+// 按 ID 获取视频当前状态，ID 查询失败时按名称在同一源中查找
+func fetchFollowSnapshot(ctx context.Context, f models.Follow) (followSnapshot, error) {
+	data, _, err := videoAPI.SearchByID(ctx, f.SourceKey, f.VodID, 0)
+	if err == nil {
+		if item, ok := data.(models.VodItem); ok {
+			return snapshotOf(item), nil
+		}
+	}
+
+	if f.VodName == "" {
+		return followSnapshot{}, err
+	}
+
+	item, ferr := findByTitle(ctx, f.SourceKey, f.VodName)
+	if ferr != nil {
+		return followSnapshot{}, fmt.Errorf("ID 查询失败: %v，按名称查找失败: %v", err, ferr)
+	}
+
+	log.Info().Ctx(ctx).
+		Str("source_key", f.SourceKey).
+		Int("old_vod_id", f.VodID).
+		Int("new_vod_id", item.VodID).
+		Str("vod_name", f.VodName).
+		Msg("按名称重新找到追剧条目")
+
+	return snapshotOf(item), nil
+}
+
+// 在指定源中按名称查找完全匹配的视频
+func findByTitle(ctx context.Context, sourceKey, name string) (models.VodItem, error) {
+	source, ok := conf.Get().GetVideoSource(sourceKey)
+	if !ok {
+		return models.VodItem{}, fmt.Errorf("视频源不存在")
+	}
+
+	var result sourceResult
+	if strings.EqualFold(source.Name, "omo") {
+		result = videoAPI.SearchOmo(ctx, name)
+	} else {
+		params := map[string]string{"ac": "videolist", "wd": name}
+		result = videoAPI.fetchFromSource(ctx, sourceKey, source, params)
+	}
+	if result.Error != nil {
+		return models.VodItem{}, result.Error
+	}
+
+	for _, item := range result.Items {
+		if strings.TrimSpace(item.VodName) == strings.TrimSpace(name) {
+			return item, nil
+		}
+	}
+	return models.VodItem{}, fmt.Errorf("没有找到同名视频")
+}
+
+func snapshotOf(item models.VodItem) followSnapshot {
+	return followSnapshot{
+		VodID:        item.VodID,
+		VodName:      item.VodName,
+		VodPic:       item.VodPic,
+		EpisodeCount: len(item.Episodes),
+		VodRemarks:   item.VodRemarks,
+		VodTime:      item.VodTime,
+	}
+}
+
+// ============ Handler ============
+
+// 收藏列表
+func ListFollows(c *gin.Context) {
+	profile := profileID(c)
+	list := GetFollowStore().List(profile)
+	Success(c, gin.H{"list": list, "total": len(list)}, gin.H{"profile": profile})
+}
+
+// 添加收藏 / 追剧，添加时获取一次当前状态作为比较基准
+func SaveFollow(c *gin.Context) {
+	profile := profileID(c)
+
+	var f models.Follow
+	if !bindBody(c, followBody, &f) {
+		return
+	}
+	if _, ok := conf.Get().GetVideoSource(f.SourceKey); !ok {
+		Error(c, 400, "视频源不存在", f.SourceKey)
+		return
+	}
+
+	f.EpisodeCount, f.VodRemarks, f.VodTime = 0, "", ""
+	f.CheckedAt, f.UpdatedAt = 0, 0
+	f.CreatedAt = time.Now().UnixMilli()
+
+	s := GetFollowStore()
+	saved, err := s.Save(profile, f)
+	if err != nil {
+		Error(c, 500, "保存收藏失败", nil)
+		return
+	}
+
+	if saved.CheckedAt == 0 {
+		if snap, err := fetchFollowSnapshot(c.Request.Context(), saved); err == nil {
+			s.apply(saved, snap)
+		} else {
+			log.Warn().Str("key", saved.Key()).Err(err).Msg("获取收藏基准状态失败，将在下次检查时重试")
+		}
+	}
+
+	log.Info().
+		Str("profile", profile).
+		Str("key", saved.Key()).
+		Bool("follow", saved.Follow).
+		Msg("添加收藏")
+
+	Success(c, saved, gin.H{"profile": profile})
+}
+
+// 删除收藏
+func DeleteFollow(c *gin.Context) {
+	profile := profileID(c)
+
+	if !checkQuery(c, deleteFollowQuery) {
+		return
+	}
+	sourceKey := c.Query("sourceKey")
+	vodID, _ := strconv.Atoi(c.Query("vodId"))
+
+	removed, err := GetFollowStore().Remove(profile, sourceKey, vodID)
+	if err != nil {
+		Error(c, 500, "删除收藏失败", nil)
+		return
+	}
+	Success(c, gin.H{"deleted": removed}, gin.H{"profile": profile})
+}
+
+// 追剧更新列表，参数 all=true 时包含已读
+func ListFollowUpdates(c *gin.Context) {
+	profile := profileID(c)
+	list := GetFollowStore().Updates(profile, c.Query("all") != "true")
+	Success(c, gin.H{"list": list, "total": len(list)}, gin.H{"profile": profile})
+}
+
+type readUpdatesRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// 标记更新为已读，不传 ids 时标记全部
+func ReadFollowUpdates(c *gin.Context) {
+	profile := profileID(c)
+
+	var req readUpdatesRequest
+	if c.Request.ContentLength > 0 && !bindBody(c, readUpdatesBody, &req) {
+		return
+	}
+
+	count, err := GetFollowStore().MarkRead(profile, req.IDs)
+	if err != nil {
+		Error(c, 500, "标记已读失败", nil)
+		return
+	}
+	Success(c, gin.H{"read": count}, gin.H{"profile": profile})
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"tv/models"
+)
+
+func newTestFollowStore(t *testing.T) *FollowStore {
+	t.Helper()
+	dir := t.TempDir()
+	return &FollowStore{
+		path:        filepath.Join(dir, "follows.json"),
+		updatesPath: filepath.Join(dir, "follow_updates.json"),
+		follows:     make(map[string]map[string]models.Follow),
+		updates:     make(map[string][]models.FollowUpdate),
+	}
+}
+
+func TestFollowApplyDetectsUpdate(t *testing.T) {
+	loadTestConfig(t, "")
+	s := newTestFollowStore(t)
+	f := models.Follow{SourceKey: "test", VodID: 1, VodName: "剧", Follow: true, CreatedAt: 1}
+	s.follows["p"] = map[string]models.Follow{f.Key(): f}
+
+	// 首次检查只记录状态
+	if updates := s.apply(f, followSnapshot{VodID: 1, VodName: "剧", EpisodeCount: 3}); len(updates) != 0 {
+		t.Fatalf("first check created updates: %+v", updates)
+	}
+	f = s.follows["p"][f.Key()]
+	updates := s.apply(f, followSnapshot{VodID: 1, VodName: "剧", EpisodeCount: 4})
+	if len(updates) != 1 || updates[0].OldEpisodeCount != 3 || updates[0].NewEpisodeCount != 4 {
+		t.Errorf("updates = %+v", updates)
+	}
+}
+
+func TestFollowApplyRekeyMerges(t *testing.T) {
+	loadTestConfig(t, "")
+	s := newTestFollowStore(t)
+	old := models.Follow{SourceKey: "test", VodID: 1, VodName: "剧", Follow: true, CreatedAt: 100, CheckedAt: 1}
+	existing := models.Follow{SourceKey: "test", VodID: 2, VodName: "剧", Follow: false, CreatedAt: 50}
+	s.follows["p"] = map[string]models.Follow{old.Key(): old, existing.Key(): existing}
+
+	// 旧 ID 失效后按名称找到的新 ID 已在收藏中
+	s.apply(old, followSnapshot{VodID: 2, VodName: "剧", EpisodeCount: 5})
+
+	items := s.follows["p"]
+	if len(items) != 1 {
+		t.Fatalf("follows after re-key = %+v", items)
+	}
+	got := items[existing.Key()]
+	if !got.Follow || got.CreatedAt != 50 || got.EpisodeCount != 5 {
+		t.Errorf("merged follow = %+v", got)
+	}
+}
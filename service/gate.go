@@ -0,0 +1,177 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"tv/conf"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const gateCookie = "ytv_gate"
+
+// Gate 全站访问密码（app.password），未设置密码时不启用
+// 放行健康检查和登录接口；API 请求返回 401 JSON，页面请求返回内置的密码输入页
+func Gate(apiPrefix string) gin.HandlerFunc {
+	exempt := map[string]bool{
+		apiPrefix + "/health":      true,
+		apiPrefix + "/gate/login":  true,
+		apiPrefix + "/gate/logout": true,
+	}
+
+	return func(c *gin.Context) {
+		if conf.Get().App.Password == "" || exempt[c.Request.URL.Path] || gateAuthorized(c) {
+			c.Next()
+			return
+		}
+
+		if strings.HasPrefix(c.Request.URL.Path, apiPrefix) {
+			abortWithStatus(c, http.StatusUnauthorized, "需要访问密码")
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusUnauthorized, "text/html; charset=utf-8", []byte(strings.ReplaceAll(gatePage, "{{API}}", apiPrefix)))
+		c.Abort()
+	}
+}
+
+// MetricsGuard 指标接口前执行的中间件：设置了 metrics.token 时只校验令牌（由 metrics.Handler 处理），
+// 没有令牌时与其他页面一样受访问密码保护
+func MetricsGuard(cfg *conf.Config) []gin.HandlerFunc {
+	if cfg.Metrics.Token != "" {
+		return nil
+	}
+	return []gin.HandlerFunc{Gate(cfg.APIPath())}
+}
+
+// 校验 Cookie 或请求头 X-Access-Token 中的访问令牌
+func gateAuthorized(c *gin.Context) bool {
+	token := c.GetHeader("X-Access-Token")
+	if token == "" {
+		token, _ = c.Cookie(gateCookie)
+	}
+	return verifyGateToken(token)
+}
+
+// 令牌格式：过期时间戳.签名，签名密钥由服务端密钥和访问密码共同派生：
+// 拿到令牌也无法离线穷举访问密码，修改密码后旧令牌自动失效
+func signGateToken(expiresAt time.Time) string {
+	payload := strconv.FormatInt(expiresAt.Unix(), 10)
+	return payload + "." + gateSignature(payload)
+}
+
+func verifyGateToken(token string) bool {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	if !hmac.Equal([]byte(sig), []byte(gateSignature(payload))) {
+		return false
+	}
+	expires, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Now().Unix() < expires
+}
+
+func gateSignature(payload string) string {
+	key := signWithSecret("gate", conf.Get().App.Password)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ============ Handler ============
+
+// 健康检查
+func Health(c *gin.Context) {
+	Success(c, gin.H{"status": "ok"}, nil)
+}
+
+type gateLoginRequest struct {
+	Password string `json:"password" form:"password"`
+}
+
+// 输入访问密码
+func GateLogin(c *gin.Context) {
+	var req gateLoginRequest
+	if err := c.ShouldBind(&req); err != nil {
+		Error(c, 400, "请求格式错误", err.Error())
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(req.Password), []byte(conf.Get().App.Password)) != 1 {
+		log.Warn().Str("ip", c.ClientIP()).Msg("访问密码错误")
+		abortWithStatus(c, http.StatusUnauthorized, "访问密码错误")
+		return
+	}
+
+	ttl := conf.Get().App.GateTTL
+	expiresAt := time.Now().Add(ttl)
+	token := signGateToken(expiresAt)
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(gateCookie, token, int(ttl.Seconds()), "/", "", isSecureRequest(c), true)
+
+	log.Info().Str("ip", c.ClientIP()).Msg("通过访问密码验证")
+	Success(c, gin.H{"token": token, "expires_at": expiresAt.UnixMilli()}, nil)
+}
+
+// 退出访问
+func GateLogout(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(gateCookie, "", -1, "/", "", isSecureRequest(c), true)
+	Success(c, nil, nil)
+}
+
+// 内置的密码输入页（前端未通过验证时无法加载，因此不依赖前端资源）
+const gatePage = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>YTV</title>
+<style>
+body{margin:0;min-height:100vh;display:flex;align-items:center;justify-content:center;font-family:system-ui,sans-serif;background:#111827;color:#f3f4f6}
+form{display:flex;flex-direction:column;gap:12px;width:280px}
+input,button{padding:10px 12px;border-radius:6px;border:1px solid #374151;font-size:15px}
+input{background:#1f2937;color:#f3f4f6}
+button{background:#2563eb;border-color:#2563eb;color:#fff;cursor:pointer}
+#msg{color:#f87171;min-height:1em;font-size:14px}
+</style>
+</head>
+<body>
+<form id="gate">
+<h2>YTV</h2>
+<input type="password" name="password" placeholder="访问密码" autofocus required>
+<button type="submit">进入</button>
+<div id="msg"></div>
+</form>
+<script>
+document.getElementById('gate').addEventListener('submit', async (e) => {
+  e.preventDefault()
+  const password = e.target.password.value
+  const resp = await fetch('{{API}}/gate/login', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ password }),
+  })
+  if (resp.ok) {
+    location.reload()
+  } else {
+    document.getElementById('msg').textContent = '密码错误'
+  }
+})
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"tv/conf"
+	"tv/metrics"
+	"tv/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGateToken(t *testing.T) {
+	loadTestConfig(t, "app:\n  password: first\n")
+
+	valid := signGateToken(time.Now().Add(time.Hour))
+	expired := signGateToken(time.Now().Add(-time.Second))
+	// 改动签名的最后一位
+	last := "0"
+	if valid[len(valid)-1] == '0' {
+		last = "1"
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{"valid", valid, true},
+		{"expired", expired, false},
+		{"empty", "", false},
+		{"no signature", "9999999999", false},
+		{"tampered expiry", "9999999999." + valid[len("9999999999."):], false},
+		{"tampered signature", valid[:len(valid)-1] + last, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyGateToken(tt.token); got != tt.want {
+				t.Errorf("verifyGateToken(%q) = %v, want %v", tt.token, got, tt.want)
+			}
+		})
+	}
+
+	// 签名密钥包含服务端密钥，仅凭访问密码无法伪造或验证令牌
+	old := serverSecret()
+	secretKey = []byte(randomID(32))
+	if verifyGateToken(valid) {
+		t.Error("token valid under a different server secret")
+	}
+	secretKey = old
+
+	// 修改访问密码后旧令牌失效
+	loadTestConfig(t, "app:\n  password: second\n")
+	if verifyGateToken(valid) {
+		t.Error("token signed with old password still valid")
+	}
+}
+
+func TestGateMiddleware(t *testing.T) {
+	loadTestConfig(t, "app:\n  password: pw\n")
+
+	r := gin.New()
+	r.Use(Gate("/api/v1"))
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+	r.GET("/api/v1/health", ok)
+	r.GET("/api/v1/search", ok)
+	r.GET("/api/v1/openapi.json", ok)
+	r.GET("/metrics", ok)
+
+	token := signGateToken(time.Now().Add(time.Hour))
+	tests := []struct {
+		path  string
+		token string
+		want  int
+	}{
+		{"/api/v1/health", "", http.StatusOK},
+		{"/api/v1/search", "", http.StatusUnauthorized},
+		{"/api/v1/search", token, http.StatusOK},
+		{"/api/v1/openapi.json", "", http.StatusUnauthorized},
+		{"/metrics", "", http.StatusUnauthorized},
+		{"/metrics", token, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("X-Access-Token", tt.token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("GET %s (token=%v) = %d, want %d", tt.path, tt.token != "", w.Code, tt.want)
+		}
+	}
+}
+
+func TestMetricsGuard(t *testing.T) {
+	scrape := func(header, value string) int {
+		cfg := conf.Get()
+		srv := server.New(server.Config{
+			APIPrefix:    cfg.Server.APIPrefix,
+			MetricsPath:  "/metrics",
+			Metrics:      metrics.Handler(cfg.Metrics.Token),
+			MetricsGuard: MetricsGuard(cfg),
+		}, func(*gin.RouterGroup) {})
+
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 没有令牌时使用访问密码
+	loadTestConfig(t, "app:\n  password: pw\n")
+	if code := scrape("", ""); code != http.StatusUnauthorized {
+		t.Errorf("no token, no gate cookie = %d, want 401", code)
+	}
+	if code := scrape("X-Access-Token", signGateToken(time.Now().Add(time.Hour))); code != http.StatusOK {
+		t.Errorf("no token, gate token = %d, want 200", code)
+	}
+
+	// 设置令牌后只校验令牌，不需要访问密码
+	loadTestConfig(t, "app:\n  password: pw\nmetrics:\n  token: m3trics\n")
+	if code := scrape("Authorization", "Bearer m3trics"); code != http.StatusOK {
+		t.Errorf("bearer token = %d, want 200", code)
+	}
+	if code := scrape("X-Access-Token", signGateToken(time.Now().Add(time.Hour))); code != http.StatusUnauthorized {
+		t.Errorf("gate token without bearer = %d, want 401", code)
+	}
+
+	// 两者都没有设置时公开
+	loadTestConfig(t, "")
+	if code := scrape("", ""); code != http.StatusOK {
+		t.Errorf("open = %d, want 200", code)
+	}
+}
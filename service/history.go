@@ -0,0 +1,383 @@
+package service
+
+import (
+	"crypto/hmac"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tv/conf"
+	"tv/models"
+	"tv/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// 删除标记保留时间，超过后彻底清除
+	historyTombstoneTTL = 30 * 24 * time.Hour
+	// 播放进度写入后延迟保存文件，合并短时间内的多次写入
+	historySaveDelay = 2 * time.Second
+)
+
+var (
+	historyStore *HistoryStore
+	historyOnce  sync.Once
+)
+
+func GetHistoryStore() *HistoryStore {
+	historyOnce.Do(func() {
+		historyStore = &HistoryStore{
+			path:  filepath.Join(conf.Get().App.DataDir, "history.json"),
+			items: make(map[string]map[string]models.PlayHistory),
+		}
+		if err := store.LoadJSON(historyStore.path, &historyStore.items); err != nil {
+			log.Error().Err(err).Str("path", historyStore.path).Msg("加载播放记录失败")
+		}
+
+		log.Info().
+			Str("path", historyStore.path).
+			Int("profiles", len(historyStore.items)).
+			Msg("播放记录存储已就绪")
+	})
+	return historyStore
+}
+
+// HistoryStore 按用户保存播放记录，合并时以 LastPlayTime 较新者为准
+type HistoryStore struct {
+	sync.RWMutex
+	path      string
+	items     map[string]map[string]models.PlayHistory // profile -> key -> record
+	saveTimer *time.Timer                              // 等待中的延迟保存
+}
+
+// List 按最近播放时间倒序返回播放记录
+func (s *HistoryStore) List(profile string, includeDeleted bool) []models.PlayHistory {
+	s.RLock()
+	defer s.RUnlock()
+
+	list := make([]models.PlayHistory, 0, len(s.items[profile]))
+	for _, h := range s.items[profile] {
+		if h.Deleted && !includeDeleted {
+			continue
+		}
+		list = append(list, h)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastPlayTime > list[j].LastPlayTime
+	})
+	return list
+}
+
+// Merge 合并播放记录（last-write-wins），返回合并后每条记录在服务端的最终版本
+// 播放进度写入频繁，文件延迟保存
+func (s *HistoryStore) Merge(profile string, records []models.PlayHistory) []models.PlayHistory {
+	s.Lock()
+	defer s.Unlock()
+
+	items := s.items[profile]
+	if items == nil {
+		items = make(map[string]models.PlayHistory)
+		s.items[profile] = items
+	}
+
+	merged := make([]models.PlayHistory, 0, len(records))
+	for _, h := range records {
+		key := h.Key()
+		if old, ok := items[key]; ok && old.LastPlayTime > h.LastPlayTime {
+			merged = append(merged, old)
+			continue
+		}
+		items[key] = h
+		merged = append(merged, h)
+	}
+
+	s.trim(profile)
+	s.saveLater()
+	return merged
+}
+
+// Delete 删除指定视频的播放记录，episodeIndex 为 nil 时删除该视频的所有剧集
+func (s *HistoryStore) Delete(profile, sourceKey string, vodID int, episodeIndex *int) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now().UnixMilli()
+	count := 0
+	for key, h := range s.items[profile] {
+		if h.Deleted || h.SourceKey != sourceKey || h.VodID != vodID {
+			continue
+		}
+		if episodeIndex != nil && h.EpisodeIndex != *episodeIndex {
+			continue
+		}
+		s.items[profile][key] = tombstone(h, now)
+		count++
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+	return count, s.save()
+}
+
+// Clear 清空用户的所有播放记录
+func (s *HistoryStore) Clear(profile string) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now().UnixMilli()
+	count := 0
+	for key, h := range s.items[profile] {
+		if h.Deleted {
+			continue
+		}
+		s.items[profile][key] = tombstone(h, now)
+		count++
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+	return count, s.save()
+}
+
+// 只保留最近的 history.max_items 条记录，并清除过期的删除标记（调用方需持有锁）
+// 超出的记录改为删除标记而不是直接删除，避免仍保存着这些记录的设备同步时重新写回
+func (s *HistoryStore) trim(profile string) {
+	items := s.items[profile]
+	expireBefore := time.Now().Add(-historyTombstoneTTL).UnixMilli()
+
+	live := make([]models.PlayHistory, 0, len(items))
+	for key, h := range items {
+		if h.Deleted {
+			if h.LastPlayTime < expireBefore {
+				delete(items, key)
+			}
+			continue
+		}
+		live = append(live, h)
+	}
+
+	max := conf.Get().History.MaxItems
+	if max <= 0 || len(live) <= max {
+		return
+	}
+
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].LastPlayTime > live[j].LastPlayTime
+	})
+	now := time.Now().UnixMilli()
+	for _, h := range live[max:] {
+		items[h.Key()] = tombstone(h, now)
+	}
+}
+
+// Flush 立即保存等待中的修改，退出前调用
+func (s *HistoryStore) Flush() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.saveTimer == nil {
+		return nil
+	}
+	return s.save()
+}
+
+// 延迟保存，等待期间的修改一起写入（调用方需持有锁）
+func (s *HistoryStore) saveLater() {
+	if s.saveTimer != nil {
+		return
+	}
+	s.saveTimer = time.AfterFunc(historySaveDelay, func() {
+		s.Lock()
+		defer s.Unlock()
+		if s.saveTimer != nil {
+			s.save()
+		}
+	})
+}
+
+// 写入文件，同时取消等待中的延迟保存（调用方需持有锁）
+func (s *HistoryStore) save() error {
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+		s.saveTimer = nil
+	}
+	if err := store.SaveJSON(s.path, s.items); err != nil {
+		log.Error().Err(err).Str("path", s.path).Msg("保存播放记录失败")
+		return err
+	}
+	return nil
+}
+
+func tombstone(h models.PlayHistory, now int64) models.PlayHistory {
+	return models.PlayHistory{
+		VodID:        h.VodID,
+		EpisodeIndex: h.EpisodeIndex,
+		SourceKey:    h.SourceKey,
+		LastPlayTime: now,
+		Deleted:      true,
+	}
+}
+
+// ============ 用户标识 ============
+
+// 未登录设备的标识 Cookie，值为 "设备ID.签名"，由服务端生成并签名，客户端无法指定其他设备的标识
+const deviceCookie = "ytv_device"
+
+// 设备标识有效期，每次访问时续期
+const deviceTTL = 365 * 24 * time.Hour
+
+// 获取数据隔离用的用户标识
+// 已登录时为 "用户ID:档案ID"；未登录时为服务端签发的设备标识 "device:设备ID"
+func profileID(c *gin.Context) string {
+	if user, ok := currentUser(c); ok {
+		profile, _ := currentProfile(c)
+		return user.ID + ":" + profile.ID
+	}
+	return "device:" + deviceID(c)
+}
+
+// 读取 Cookie 或请求头 X-Device-Token 中的设备标识，没有或签名无效时签发新的标识
+func deviceID(c *gin.Context) string {
+	token := c.GetHeader("X-Device-Token")
+	if token == "" {
+		token, _ = c.Cookie(deviceCookie)
+	}
+	id, ok := verifyDeviceToken(token)
+	if !ok {
+		id = randomID(16)
+		token = id + "." + signWithSecret("device", id)
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(deviceCookie, token, int(deviceTTL.Seconds()), "/", "", isSecureRequest(c), true)
+	c.Header("X-Device-Token", token)
+	return id
+}
+
+func verifyDeviceToken(token string) (string, bool) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, hmac.Equal([]byte(sig), []byte(signWithSecret("device", id)))
+}
+
+// ============ Handler ============
+
+// 获取播放记录列表
+func ListHistory(c *gin.Context) {
+	profile := profileID(c)
+	list := GetHistoryStore().List(profile, false)
+
+	log.Debug().
+		Str("profile", profile).
+		Int("count", len(list)).
+		Msg("获取播放记录")
+
+	Success(c, gin.H{"list": list, "total": len(list)}, gin.H{"profile": profile})
+}
+
+// 保存单条播放进度
+func SaveHistory(c *gin.Context) {
+	profile := profileID(c)
+
+	var h models.PlayHistory
+	if !bindBody(c, historyBody, &h) {
+		return
+	}
+	if h.LastPlayTime == 0 {
+		h.LastPlayTime = time.Now().UnixMilli()
+	}
+
+	merged := GetHistoryStore().Merge(profile, []models.PlayHistory{h})
+
+	log.Debug().
+		Str("profile", profile).
+		Str("key", h.Key()).
+		Float64("progress", h.Progress).
+		Msg("播放进度已保存")
+
+	Success(c, merged[0], gin.H{"profile": profile})
+}
+
+type syncHistoryRequest struct {
+	List []models.PlayHistory `json:"list"`
+}
+
+// 同步本地播放记录：合并客户端记录后返回服务端全部记录（包含删除标记）
+func SyncHistory(c *gin.Context) {
+	profile := profileID(c)
+
+	var req syncHistoryRequest
+	if !bindBody(c, syncHistoryBody, &req) {
+		return
+	}
+
+	s := GetHistoryStore()
+	s.Merge(profile, req.List)
+	list := s.List(profile, true)
+
+	log.Info().
+		Str("profile", profile).
+		Int("received", len(req.List)).
+		Int("total", len(list)).
+		Msg("播放记录同步完成")
+
+	Success(c, gin.H{"list": list, "total": len(list)}, gin.H{"profile": profile})
+}
+
+// 删除指定视频的播放记录
+func DeleteHistory(c *gin.Context) {
+	profile := profileID(c)
+
+	if !checkQuery(c, deleteHistoryQuery) {
+		return
+	}
+	sourceKey := c.Query("sourceKey")
+	vodID, _ := strconv.Atoi(c.Query("vodId"))
+
+	var episodeIndex *int
+	if s := c.Query("episodeIndex"); s != "" {
+		idx, _ := strconv.Atoi(s)
+		episodeIndex = &idx
+	}
+
+	count, err := GetHistoryStore().Delete(profile, sourceKey, vodID, episodeIndex)
+	if err != nil {
+		Error(c, 500, "删除播放记录失败", nil)
+		return
+	}
+
+	log.Info().
+		Str("profile", profile).
+		Str("source_key", sourceKey).
+		Int("vod_id", vodID).
+		Int("count", count).
+		Msg("删除播放记录")
+
+	Success(c, gin.H{"deleted": count}, gin.H{"profile": profile})
+}
+
+// 清空播放记录
+func ClearHistory(c *gin.Context) {
+	profile := profileID(c)
+
+	count, err := GetHistoryStore().Clear(profile)
+	if err != nil {
+		Error(c, 500, "清空播放记录失败", nil)
+		return
+	}
+
+	log.Info().
+		Str("profile", profile).
+		Int("count", count).
+		Msg("清空播放记录")
+
+	Success(c, gin.H{"deleted": count}, gin.H{"profile": profile})
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tv/models"
+	"tv/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestHistoryStore(t *testing.T) *HistoryStore {
+	t.Helper()
+	return &HistoryStore{
+		path:  filepath.Join(t.TempDir(), "history.json"),
+		items: make(map[string]map[string]models.PlayHistory),
+	}
+}
+
+func record(vodID int, lastPlay int64, progress float64) models.PlayHistory {
+	return models.PlayHistory{SourceKey: "test", VodID: vodID, LastPlayTime: lastPlay, Progress: progress}
+}
+
+func TestHistoryMergeLastWriteWins(t *testing.T) {
+	loadTestConfig(t, "")
+	s := newTestHistoryStore(t)
+
+	s.Merge("p", []models.PlayHistory{record(1, 200, 50)})
+
+	// 较旧的记录不会覆盖服务端版本，返回服务端的最终版本
+	merged := s.Merge("p", []models.PlayHistory{record(1, 100, 10)})
+	if merged[0].Progress != 50 {
+		t.Errorf("older record overwrote newer one: %+v", merged[0])
+	}
+
+	merged = s.Merge("p", []models.PlayHistory{record(1, 300, 80)})
+	if merged[0].Progress != 80 {
+		t.Errorf("newer record not applied: %+v", merged[0])
+	}
+
+	// 不同用户互不影响
+	if list := s.List("other", true); len(list) != 0 {
+		t.Errorf("other profile sees %d records", len(list))
+	}
+}
+
+func TestHistoryDeleteTombstone(t *testing.T) {
+	loadTestConfig(t, "")
+	s := newTestHistoryStore(t)
+	s.Merge("p", []models.PlayHistory{record(1, 100, 10), record(2, 100, 10)})
+
+	count, err := s.Delete("p", "test", 1, nil)
+	if err != nil || count != 1 {
+		t.Fatalf("Delete = %d, %v", count, err)
+	}
+	if list := s.List("p", false); len(list) != 1 || list[0].VodID != 2 {
+		t.Errorf("List after delete = %+v", list)
+	}
+
+	// 其他设备同步删除前的旧记录时不会恢复
+	s.Merge("p", []models.PlayHistory{record(1, 100, 10)})
+	if list := s.List("p", false); len(list) != 1 {
+		t.Errorf("deleted record resurrected by stale sync: %+v", list)
+	}
+	all := s.List("p", true)
+	if len(all) != 2 {
+		t.Fatalf("tombstone missing from full list: %+v", all)
+	}
+}
+
+func TestHistoryTrimWritesTombstones(t *testing.T) {
+	loadTestConfig(t, "history:\n  max_items: 2\n")
+	s := newTestHistoryStore(t)
+	s.Merge("p", []models.PlayHistory{record(1, 100, 0), record(2, 200, 0), record(3, 300, 0)})
+
+	live := s.List("p", false)
+	if len(live) != 2 || live[0].VodID != 3 || live[1].VodID != 2 {
+		t.Fatalf("live records = %+v", live)
+	}
+
+	// 被裁剪的记录以删除标记保留，旧设备同步时不会写回
+	s.Merge("p", []models.PlayHistory{record(1, 100, 0)})
+	if live := s.List("p", false); len(live) != 2 {
+		t.Errorf("trimmed record resurrected: %+v", live)
+	}
+}
+
+func TestHistoryDeferredSave(t *testing.T) {
+	loadTestConfig(t, "")
+	s := newTestHistoryStore(t)
+	s.Merge("p", []models.PlayHistory{record(1, 100, 10)})
+
+	var onDisk map[string]map[string]models.PlayHistory
+	if err := store.LoadJSON(s.path, &onDisk); err != nil || len(onDisk) != 0 {
+		t.Fatalf("progress saved immediately: %v %v", onDisk, err)
+	}
+
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.LoadJSON(s.path, &onDisk); err != nil || len(onDisk["p"]) != 1 {
+		t.Errorf("Flush did not save: %v %v", onDisk, err)
+	}
+}
+
+func TestProfileIDAnonymousDevice(t *testing.T) {
+	loadTestConfig(t, "")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/history", nil)
+	first := profileID(c)
+	token := w.Header().Get("X-Device-Token")
+	if token == "" {
+		t.Fatal("device token not issued")
+	}
+
+	// 带上签发的标识时保持同一用户
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/history", nil)
+	c.Request.Header.Set("X-Device-Token", token)
+	if got := profileID(c); got != first {
+		t.Errorf("profileID with issued token = %q, want %q", got, first)
+	}
+
+	// 客户端自行指定的标识无效
+	id, _, _ := strings.Cut(token, ".")
+	for _, forged := range []string{id, id + ".bad", "other." + strings.Split(token, ".")[1]} {
+		c, _ = gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/history?profile="+id, nil)
+		c.Request.Header.Set("X-Device-Token", forged)
+		c.Request.Header.Set("X-Profile-ID", id)
+		if got := profileID(c); got == first {
+			t.Errorf("forged token %q accepted", forged)
+		}
+	}
+}
@@ -1,14 +1,18 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 	"tv/cache"
+	"tv/metrics"
 	"tv/models"
+	"tv/tracing"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var doubanClient = NewClient(
@@ -47,68 +51,92 @@ type DoubanRespReturn struct {
 
 func HotMovies(c *gin.Context) {
 	// 获取查询参数
-	params := map[string]string{
+	if !checkQuery(c, hotQuery) {
+		return
+	}
+	params := hotParams(c)
+	log.Debug().Str("path", "/hots").Interface("params", params).Msg("开始处理 HotMovies 请求")
+
+	// 构建缓存 key
+	cacheKey := hotCacheKey(params)
+
+	// 读取缓存，未命中时请求豆瓣；相同参数的并发请求只请求一次，结果由 FetchHot 存入缓存
+	res, err := cache.GetCacher().FetchHot(c.Request.Context(), cacheKey, func(ctx context.Context) (models.APIResponse, error) {
+		data, err := fetchDoubanHot(ctx, params)
+		return models.APIResponse{Data: data, Extra: params}, err
+	})
+	if err != nil {
+		Fail(c, err, nil)
+		return
+	}
+
+	// 返回响应
+	Success(c, res.Data, res.Extra)
+	log.Debug().Msg("HotMovies 请求处理完成")
+}
+
+// 解析热门接口查询参数
+func hotParams(c *gin.Context) map[string]string {
+	return map[string]string{
 		"type":       c.DefaultQuery("type", "movie"),
 		"tag":        c.DefaultQuery("tag", "热门"),
 		"sort":       c.DefaultQuery("sort", "recommend"),
 		"page_limit": c.DefaultQuery("page_limit", "16"),
 		"page_start": c.DefaultQuery("page_start", "0"),
 	}
-	log.Debug().Str("path", "/hots").Interface("params", params).Msg("开始处理 HotMovies 请求")
+}
 
-	// 构建缓存 key
-	cacheKey := cache.HotParams{
+func hotCacheKey(params map[string]string) cache.HotParams {
+	return cache.HotParams{
 		Type:      params["type"],
 		Tag:       params["tag"],
 		Sort:      params["sort"],
 		PageLimit: params["page_limit"],
 		PageStart: params["page_start"],
 	}
+}
 
-	// 读取缓存
-	if cachedData, ok := cache.GetCacher().GetHot(cacheKey); ok {
-		log.Debug().Interface("cacheKey", cacheKey).Msg("命中缓存，直接返回数据")
-		Success(c, cachedData.Data, cachedData.Extra)
-		return
-	}
-	log.Debug().Interface("cacheKey", cacheKey).Msg("缓存未命中，准备请求豆瓣 API")
+// 请求豆瓣热门接口
+func fetchDoubanHot(ctx context.Context, params map[string]string) (_ DoubanRespReturn, err error) {
+	start := time.Now()
+	outcome := "success"
+	ctx, span := tracing.Start(ctx, "douban.search_subjects",
+		attribute.String("douban.type", params["type"]),
+		attribute.String("douban.tag", params["tag"]),
+	)
+	defer func() {
+		metrics.ObserveDouban("search_subjects", outcome, time.Since(start))
+		span.SetAttributes(attribute.String("douban.outcome", outcome))
+		tracing.End(span, err)
+	}()
 
-	// 请求豆瓣 API
 	resp, err := doubanClient.resty.R().
+		SetContext(ctx).
 		SetQueryParams(params).
 		Get("/j/search_subjects")
 	if err != nil {
-		log.Error().Err(err).Str("url", "/j/search_subjects").Interface("params", params).Msg("请求豆瓣热搜失败")
-		Error(c, 500, "请求豆瓣热搜失败", nil)
-		return
+		outcome = "error"
+		log.Error().Ctx(ctx).Err(err).Str("url", "/j/search_subjects").Interface("params", params).Msg("请求豆瓣热搜失败")
+		return DoubanRespReturn{}, upstreamError(err, "请求豆瓣热搜失败")
 	}
-	log.Debug().Int("status_code", resp.StatusCode()).Msg("豆瓣 API 请求完成")
+	log.Debug().Ctx(ctx).Int("status_code", resp.StatusCode()).Msg("豆瓣 API 请求完成")
 
 	// 解析响应
 	var doubanResp DoubanResponse
 	if err := json.Unmarshal(resp.Body(), &doubanResp); err != nil {
-		log.Error().Err(err).Str("body", string(resp.Body())).Msg("解析 JSON 失败")
-		Error(c, 500, "解析 JSON 失败", string(resp.Body()))
-		return
+		// 被豆瓣限制时通常返回 403 页面
+		log.Error().Ctx(ctx).Err(err).Str("body", string(resp.Body())).Msg("解析 JSON 失败")
+		if resp.IsError() {
+			outcome = "bad_status"
+			return DoubanRespReturn{}, upstreamStatusError(resp.StatusCode())
+		}
+		outcome = "bad_body"
+		return DoubanRespReturn{}, upstreamParseError(err, "解析豆瓣响应失败")
 	}
-	log.Debug().Int("subjects_count", len(doubanResp.Subjects)).Msg("豆瓣热搜解析成功")
+	log.Debug().Ctx(ctx).Int("subjects_count", len(doubanResp.Subjects)).Msg("豆瓣热搜解析成功")
 
-	// 构建响应数据
-	data := DoubanRespReturn{
+	return DoubanRespReturn{
 		Total: len(doubanResp.Subjects),
 		List:  doubanResp.Subjects,
-	}
-
-	// 缓存数据
-	cache.GetCacher().SetHot(cacheKey, models.APIResponse{
-		Code:    0,
-		Message: "",
-		Data:    data,
-		Extra:   params,
-	})
-	log.Debug().Msg("数据已缓存成功")
-
-	// 返回响应
-	Success(c, data, params)
-	log.Debug().Msg("HotMovies 请求处理完成")
+	}, nil
 }
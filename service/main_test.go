@@ -0,0 +1,42 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tv/conf"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+// 加载测试配置，data_dir 指向临时目录，extra 为追加的 YAML 内容
+// extra 中没有 sources 时添加一个无法访问的测试源
+func loadTestConfig(t *testing.T, extra string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("YTV_APP_DATA_DIR", filepath.Join(dir, "data"))
+	yaml := extra
+	if !strings.HasPrefix(extra, "sources:") && !strings.Contains(extra, "\nsources:") {
+		yaml += `
+sources:
+  test:
+    api: "http://127.0.0.1:1/api.php/provide/vod"
+    name: "测试源"
+`
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := conf.InitConfig(path); err != nil {
+		t.Fatal(err)
+	}
+}
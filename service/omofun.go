@@ -1,79 +1,97 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"tv/metrics"
 	"tv/models"
+	"tv/tracing"
+	"tv/upstream"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gocolly/colly"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ==================== 公开方法 ====================
 
 // 通过关键词搜索 Omo 视频
-func (api *VideoAPI) SearchOmo(keyword string) sourceResult {
+func (api *VideoAPI) SearchOmo(ctx context.Context, keyword string) sourceResult {
 	start := time.Now()
 	result := sourceResult{
 		SourceKey:  "omo",
 		SourceName: "Omo",
 	}
-
-	log.Debug().
+	ctx, span := tracing.Start(ctx, "omo.search", attribute.String("omo.keyword", keyword))
+	defer func() {
+		metrics.ObserveUpstream(result.SourceKey, time.Since(start), result.Error)
+		span.SetAttributes(attribute.Int("source.items", len(result.Items)))
+		tracing.End(span, result.Error)
+	}()
+
+	log.Debug().Ctx(ctx).
 		Str("source", "omo").
 		Str("keyword", keyword).
 		Msg("开始搜索 Omo")
 
-	items, err := api.scrapeOmoSearch(keyword)
+	items, err := api.scrapeOmoSearch(ctx, keyword)
 	result.Duration = time.Since(start).Milliseconds()
 
 	if err != nil {
-		result.Error = fmt.Errorf("搜索失败: %v", err)
-		log.Error().
+		result.Error = fmt.Errorf("搜索失败: %w", err)
+		log.Error().Ctx(ctx).
 			Str("source", "omo").
 			Err(err).
 			Int64("duration_ms", result.Duration).
 			Msg("Omo 搜索失败")
+		recordSourceResult(result.SourceKey, result.SourceName, result.Error)
 		return result
 	}
 
 	result.Items = items
-	log.Debug().
+	log.Debug().Ctx(ctx).
 		Str("source", "omo").
 		Int("items", len(result.Items)).
 		Int64("duration_ms", result.Duration).
 		Msg("Omo 搜索完成")
 
+	recordSourceResult(result.SourceKey, result.SourceName, nil)
 	return result
 }
 
 // GetOmoDetail 通过 ID 和集数索引获取 Omo 视频详情（包含播放地址）
 // vodID: 视频 ID
 // index: 集数索引（从 0 开始）
-func (api *VideoAPI) GetOmoDetail(vodID int, index int) sourceResult {
+func (api *VideoAPI) GetOmoDetail(ctx context.Context, vodID int, index int) sourceResult {
 	start := time.Now()
 	result := sourceResult{
 		SourceKey:  "omo",
 		SourceName: "Omo",
 	}
+	ctx, span := tracing.Start(ctx, "omo.detail", attribute.Int("omo.vod_id", vodID), attribute.Int("omo.index", index))
+	defer func() {
+		metrics.ObserveUpstream(result.SourceKey, time.Since(start), result.Error)
+		tracing.End(span, result.Error)
+	}()
 
-	log.Debug().
+	log.Debug().Ctx(ctx).
 		Str("source", "omo").
 		Int("vod_id", vodID).
 		Int("index", index).
 		Msg("开始获取 Omo 详情")
 
-	item, err := api.scrapeOmoPlayPage(vodID, index)
+	item, err := api.scrapeOmoPlayPage(ctx, vodID, index)
 	result.Duration = time.Since(start).Milliseconds()
 
 	if err != nil {
-		result.Error = fmt.Errorf("获取详情失败: %v", err)
-		log.Error().
+		result.Error = fmt.Errorf("获取详情失败: %w", err)
+		log.Error().Ctx(ctx).
 			Str("source", "omo").
 			Int("vod_id", vodID).
 			Err(err).
@@ -83,7 +101,7 @@ func (api *VideoAPI) GetOmoDetail(vodID int, index int) sourceResult {
 	}
 
 	result.Items = []models.VodItem{item}
-	log.Debug().
+	log.Debug().Ctx(ctx).
 		Str("source", "omo").
 		Int("vod_id", vodID).
 		Int("episodes", len(item.Episodes)).
@@ -96,12 +114,13 @@ func (api *VideoAPI) GetOmoDetail(vodID int, index int) sourceResult {
 // ==================== 私有爬虫方法 ====================
 
 // scrapeOmoSearch 爬取搜索结果页
-func (api *VideoAPI) scrapeOmoSearch(keyword string) ([]models.VodItem, error) {
+func (api *VideoAPI) scrapeOmoSearch(ctx context.Context, keyword string) ([]models.VodItem, error) {
 	searchCollector := colly.NewCollector(
 		colly.AllowedDomains("www.omofun.link", "omofun.link"),
 		colly.Async(true),
 		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36"),
 	)
+	searchCollector.WithTransport(contextTransport{ctx: ctx, base: upstream.Transport()})
 
 	var mu sync.Mutex
 	vodList := make([]models.VodItem, 0)
@@ -114,7 +133,7 @@ func (api *VideoAPI) scrapeOmoSearch(keyword string) ([]models.VodItem, error) {
 		idStr := strings.TrimSuffix(strings.TrimPrefix(link, "/vod/detail/id/"), ".html")
 		vodID, err := strconv.Atoi(idStr)
 		if err != nil {
-			log.Warn().Str("id_str", idStr).Msg("无法解析 VOD ID")
+			log.Warn().Ctx(ctx).Str("id_str", idStr).Msg("无法解析 VOD ID")
 			return
 		}
 
@@ -138,7 +157,7 @@ func (api *VideoAPI) scrapeOmoSearch(keyword string) ([]models.VodItem, error) {
 	// 错误处理
 	searchCollector.OnError(func(r *colly.Response, err error) {
 		scrapeErr = err
-		log.Error().Err(err).Str("url", r.Request.URL.String()).Msg("Omo 搜索页错误")
+		log.Error().Ctx(ctx).Err(err).Str("url", r.Request.URL.String()).Msg("Omo 搜索页错误")
 	})
 
 	// 并发限制
@@ -153,18 +172,23 @@ func (api *VideoAPI) scrapeOmoSearch(keyword string) ([]models.VodItem, error) {
 
 	// 访问搜索页
 	searchURL := "https://www.omofun.link/vod/search/page/1/wd/" + keyword + ".html"
+	_, span := tracing.Start(ctx, "omo.search_page", attribute.String("http.url", searchURL))
 	if err := searchCollector.Visit(searchURL); err != nil {
-		return nil, fmt.Errorf("访问搜索页失败: %v", err)
+		err = upstreamError(err, "访问搜索页失败")
+		tracing.End(span, err)
+		return nil, err
 	}
 
 	searchCollector.Wait()
+	span.SetAttributes(attribute.Int("omo.results", len(vodList)))
+	tracing.End(span, scrapeErr)
 
 	if scrapeErr != nil {
-		return nil, scrapeErr
+		return nil, upstreamError(scrapeErr, "访问搜索页失败")
 	}
 
 	// 为每个视频获取剧集列表（不包含播放地址）
-	log.Debug().Int("vod_count", len(vodList)).Msg("开始获取剧集列表")
+	log.Debug().Ctx(ctx).Int("vod_count", len(vodList)).Msg("开始获取剧集列表")
 
 	var wg sync.WaitGroup
 	for i := range vodList {
@@ -172,9 +196,9 @@ func (api *VideoAPI) scrapeOmoSearch(keyword string) ([]models.VodItem, error) {
 		go func(idx int) {
 			defer wg.Done()
 
-			episodes, err := api.scrapeEpisodeList(vodList[idx].VodID)
+			episodes, err := api.scrapeEpisodeList(ctx, vodList[idx].VodID)
 			if err != nil {
-				log.Warn().
+				log.Warn().Ctx(ctx).
 					Int("vod_id", vodList[idx].VodID).
 					Err(err).
 					Msg("获取剧集列表失败")
@@ -192,24 +216,29 @@ func (api *VideoAPI) scrapeOmoSearch(keyword string) ([]models.VodItem, error) {
 }
 
 // scrapeEpisodeList 获取指定视频的剧集列表（不包含播放地址）
-func (api *VideoAPI) scrapeEpisodeList(vodID int) ([]models.Episode, error) {
+func (api *VideoAPI) scrapeEpisodeList(ctx context.Context, vodID int) (episodes []models.Episode, err error) {
 	detailURL := fmt.Sprintf("https://www.omofun.link/vod/detail/id/%d.html", vodID)
+	_, span := tracing.Start(ctx, "omo.episode_list", attribute.Int("omo.vod_id", vodID))
+	defer func() {
+		span.SetAttributes(attribute.Int("omo.episodes", len(episodes)))
+		tracing.End(span, err)
+	}()
 
-	resp, err := api.client.R().Get(detailURL)
+	resp, err := api.client.R().SetContext(ctx).Get(detailURL)
 	if err != nil {
-		return nil, fmt.Errorf("访问详情页失败: %v", err)
+		return nil, upstreamError(err, "访问详情页失败")
 	}
 
 	if resp.StatusCode() != 200 {
-		return nil, fmt.Errorf("HTTP 状态码 %d", resp.StatusCode())
+		return nil, upstreamStatusError(resp.StatusCode())
 	}
 
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(resp.String()))
 	if err != nil {
-		return nil, fmt.Errorf("解析 HTML 失败: %v", err)
+		return nil, upstreamParseError(err, "解析 HTML 失败")
 	}
 
-	episodes := make([]models.Episode, 0)
+	episodes = make([]models.Episode, 0)
 
 	// 提取第二个 module-list 的剧集
 	doc.Find(".module-list:nth-of-type(2) a.module-play-list-link").Each(func(i int, s *goquery.Selection) {
@@ -238,23 +267,26 @@ func (api *VideoAPI) scrapeEpisodeList(vodID int) ([]models.Episode, error) {
 		episodes = append(episodes, episode)
 	})
 
-	return episodes, nil
+	return normalizeEpisodes(episodes), nil
 }
 
 // getPlayerUrl 从播放页面提取真实播放地址
-func (api *VideoAPI) getPlayerUrl(url string) (string, error) {
-	resp, err := api.client.R().Get(url)
+func (api *VideoAPI) getPlayerUrl(ctx context.Context, url string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "omo.player_url")
+	defer func() { tracing.End(span, err) }()
+
+	resp, err := api.client.R().SetContext(ctx).Get(url)
 	if err != nil {
-		return "", fmt.Errorf("访问播放页失败: %v", err)
+		return "", upstreamError(err, "访问播放页失败")
 	}
 
 	if resp.StatusCode() != 200 {
-		return "", fmt.Errorf("HTTP 状态码 %d", resp.StatusCode())
+		return "", upstreamStatusError(resp.StatusCode())
 	}
 
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(resp.String()))
 	if err != nil {
-		return "", fmt.Errorf("解析 HTML 失败: %v", err)
+		return "", upstreamParseError(err, "解析 HTML 失败")
 	}
 
 	var playURL string
@@ -266,39 +298,41 @@ func (api *VideoAPI) getPlayerUrl(url string) (string, error) {
 			if m := re.FindStringSubmatch(scriptText); len(m) > 1 {
 				raw := m[1]
 				playURL = strings.ReplaceAll(raw, `\/`, `/`)
-				log.Debug().Str("play_url", playURL).Msg("成功提取播放地址")
+				log.Debug().Ctx(ctx).Str("play_url", playURL).Msg("成功提取播放地址")
 			}
 		}
 	})
 
 	if playURL == "" {
-		return "", fmt.Errorf("找不到播放地址")
+		return "", upstreamParseError(nil, "找不到播放地址")
 	}
 
 	return playURL, nil
 }
 
 // scrapeOmoPlayPage 直接爬取播放页面获取视频信息和播放地址
-func (api *VideoAPI) scrapeOmoPlayPage(vodID int, index int) (models.VodItem, error) {
+func (api *VideoAPI) scrapeOmoPlayPage(ctx context.Context, vodID int, index int) (_ models.VodItem, err error) {
 	// 构建播放页 URL（网站的 nid 从 1 开始，所以要 +1）
 	playPageURL := fmt.Sprintf("https://www.omofun.link/vod/play/id/%d/sid/8/nid/%d.html", vodID, index+1)
+	ctx, span := tracing.Start(ctx, "omo.play_page", attribute.Int("omo.vod_id", vodID), attribute.Int("omo.index", index))
+	defer func() { tracing.End(span, err) }()
 
-	log.Debug().
+	log.Debug().Ctx(ctx).
 		Str("play_page_url", playPageURL).
 		Msg("开始访问播放页")
 
-	resp, err := api.client.R().Get(playPageURL)
+	resp, err := api.client.R().SetContext(ctx).Get(playPageURL)
 	if err != nil {
-		return models.VodItem{}, fmt.Errorf("访问播放页失败: %v", err)
+		return models.VodItem{}, upstreamError(err, "访问播放页失败")
 	}
 
 	if resp.StatusCode() != 200 {
-		return models.VodItem{}, fmt.Errorf("HTTP 状态码 %d", resp.StatusCode())
+		return models.VodItem{}, upstreamStatusError(resp.StatusCode())
 	}
 
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(resp.String()))
 	if err != nil {
-		return models.VodItem{}, fmt.Errorf("解析 HTML 失败: %v", err)
+		return models.VodItem{}, upstreamParseError(err, "解析 HTML 失败")
 	}
 
 	vod := models.VodItem{
@@ -315,13 +349,13 @@ func (api *VideoAPI) scrapeOmoPlayPage(vodID int, index int) (models.VodItem, er
 			re := regexp.MustCompile(`var vod_name='([^']+)'`)
 			if matches := re.FindStringSubmatch(scriptText); len(matches) > 1 {
 				vod.VodName = matches[1]
-				log.Debug().Str("vod_name", vod.VodName).Msg("提取到视频名称")
+				log.Debug().Ctx(ctx).Str("vod_name", vod.VodName).Msg("提取到视频名称")
 			}
 		}
 	})
 
 	// 2. 提取剧集（第二个 module-list）
-	log.Debug().Msg("开始提取剧集列表")
+	log.Debug().Ctx(ctx).Msg("开始提取剧集列表")
 
 	doc.Find(".player-list .module-list:nth-of-type(2) a.module-play-list-link").Each(func(i int, s *goquery.Selection) {
 		href, exists := s.Attr("href")
@@ -349,35 +383,38 @@ func (api *VideoAPI) scrapeOmoPlayPage(vodID int, index int) (models.VodItem, er
 		vod.Episodes = append(vod.Episodes, episode)
 	})
 
-	log.Debug().
+	log.Debug().Ctx(ctx).
 		Int("total_episodes", len(vod.Episodes)).
 		Msg("剧集列表提取完成")
 
 	// 验证视频信息
 	if vod.VodName == "" {
-		return vod, fmt.Errorf("未找到视频信息")
+		return vod, notFoundError("未找到视频信息")
 	}
 
 	if len(vod.Episodes) == 0 {
-		return vod, fmt.Errorf("未找到剧集列表")
+		return vod, notFoundError("未找到剧集列表")
 	}
 
 	// 验证请求的集数是否存在
 	if index < 0 || index >= len(vod.Episodes) {
-		return vod, fmt.Errorf("集数索引 %d 超出范围 (0-%d)", index, len(vod.Episodes)-1)
+		return vod, validationError("集数索引 %d 超出范围 (0-%d)", index, len(vod.Episodes)-1)
 	}
 
 	// 3. 获取指定集数的播放地址
-	playURL, err := api.getPlayerUrl(vod.Episodes[index].URL)
+	playURL, err := api.getPlayerUrl(ctx, vod.Episodes[index].URL)
 	if err != nil {
-		return vod, fmt.Errorf("获取播放地址失败: %v", err)
+		return vod, fmt.Errorf("获取播放地址失败: %w", err)
 	}
 
 	vod.Episodes[index].URL = playURL
-	log.Debug().
+	log.Debug().Ctx(ctx).
 		Int("episode_index", index).
 		Str("play_url", playURL).
 		Msg("成功获取播放地址")
 
+	// 排序会改变位置，必须在按位置取播放地址之后进行
+	vod.Episodes = normalizeEpisodes(vod.Episodes)
+
 	return vod, nil
 }
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"tv/cache"
+	"tv/conf"
+	"tv/models"
+	"tv/openapi"
+	"tv/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ============ 查询参数 ============
+
+// 查询参数定义，同时用于生成接口文档和校验请求
+var (
+	searchQuery = []openapi.Param{
+		{Name: "wd", Description: "搜索关键词", Required: true, MaxLength: 100},
+		{Name: "pg", Type: openapi.Integer, Description: "页码", Default: "1", Min: 1, Max: 100},
+		{Name: "adult", Type: openapi.Boolean, Description: "是否包含成人视频源", Default: "false"},
+	}
+
+	vodQuery = []openapi.Param{
+		sourceKeyParam,
+		vodIDParam,
+		{Name: "episodeIndex", Type: openapi.Integer, Description: "剧集序号，从 0 开始", Required: true},
+		{Name: "line", Description: "优先选择的播放线路", MaxLength: 64},
+		{Name: "probe", Type: openapi.Boolean, Description: "是否检测剧集链接，默认使用 probe.enabled；未登录时只能关闭检测"},
+		{Name: "hideBroken", Type: openapi.Boolean, Description: "是否隐藏失效的剧集，默认使用 probe.hide_broken"},
+	}
+
+	hotQuery = []openapi.Param{
+		{Name: "type", Description: "类型", Default: "movie", Enum: []string{"movie", "tv"}},
+		{Name: "tag", Description: "豆瓣标签", Default: "热门", MaxLength: 20},
+		{Name: "sort", Description: "排序方式", Default: "recommend", Enum: []string{"recommend", "time", "rank"}},
+		{Name: "page_limit", Type: openapi.Integer, Description: "每页数量", Default: "16", Min: 1, Max: 100},
+		{Name: "page_start", Type: openapi.Integer, Description: "起始位置", Default: "0", Min: 0},
+	}
+
+	// 管理接口刷新 ID 缓存时 episodeIndex 可以省略
+	refreshVodQuery = []openapi.Param{
+		sourceKeyParam,
+		vodIDParam,
+		{Name: "episodeIndex", Type: openapi.Integer, Description: "剧集序号，从 0 开始", Default: "0"},
+	}
+
+	deleteHistoryQuery = []openapi.Param{
+		sourceKeyParam,
+		vodIDParam,
+		{Name: "episodeIndex", Type: openapi.Integer, Description: "剧集序号，不传时删除该视频的全部记录"},
+	}
+
+	deleteFollowQuery = []openapi.Param{sourceKeyParam, vodIDParam}
+
+	sourceKeyParam = openapi.Param{Name: "sourceKey", Description: "视频源 key", Required: true, MaxLength: 32}
+	vodIDParam     = openapi.Param{Name: "vodId", Type: openapi.Integer, Description: "视频 ID", Required: true, Min: 1}
+)
+
+// ============ 请求体 ============
+
+// 请求体字段定义，同时用于生成接口文档和校验请求，未列出的字段不校验
+var (
+	historyBody = []openapi.Param{
+		{Name: "sourceKey", Description: "视频源 key", Required: true, MaxLength: 32},
+		{Name: "vod_id", Type: openapi.Integer, Description: "视频 ID", Required: true, Min: 1},
+		{Name: "episode_index", Type: openapi.Integer, Description: "剧集序号，从 0 开始", Min: 0},
+		{Name: "name", Description: "视频名称", MaxLength: 200},
+		{Name: "episode_title", Description: "剧集标题", MaxLength: 100},
+		{Name: "lastPlayTime", Type: openapi.Integer, Description: "毫秒时间戳，不传时使用服务器时间", Min: 0},
+		{Name: "progress", Type: openapi.Number, Description: "播放进度（秒）", Min: 0},
+		{Name: "duration", Type: openapi.Number, Description: "视频总时长（秒）", Min: 0},
+		{Name: "deleted", Type: openapi.Boolean, Description: "删除标记"},
+	}
+
+	syncHistoryBody = []openapi.Param{
+		{Name: "list", Type: openapi.Array, Description: "本地播放记录", Max: 1000, Items: historyBody},
+	}
+
+	followBody = []openapi.Param{
+		{Name: "source_key", Description: "视频源 key", Required: true, MaxLength: 32},
+		{Name: "vod_id", Type: openapi.Integer, Description: "视频 ID", Required: true, Min: 1},
+		{Name: "vod_name", Description: "视频名称，源中 ID 失效时按名称重新查找", MaxLength: 200},
+		{Name: "vod_pic", Description: "封面地址", MaxLength: 1000},
+		{Name: "follow", Type: openapi.Boolean, Description: "true 为追剧，false 为仅收藏"},
+	}
+
+	readUpdatesBody = []openapi.Param{
+		{Name: "ids", Type: openapi.Array, Description: "更新记录 ID，不传时标记全部", Max: 1000},
+	}
+
+	sourceBody = []openapi.Param{
+		{Name: "api", Description: "采集接口地址", Required: true, MaxLength: 500},
+		{Name: "name", Description: "视频源名称", Required: true, MaxLength: 64},
+		{Name: "detail", Description: "详情页地址", MaxLength: 500},
+		{Name: "adult", Type: openapi.Boolean, Description: "成人源，不参与默认搜索"},
+		{Name: "disabled", Type: openapi.Boolean, Description: "停用"},
+		{Name: "rate_limit", Type: openapi.Number, Description: "每秒请求数，0 表示使用 upstream.sources", Min: 0},
+		{Name: "burst", Type: openapi.Integer, Description: "允许的突发请求数", Min: 0},
+		{Name: "proxy", Description: "代理地址，direct 表示直连", MaxLength: 500},
+	}
+
+	createSourceBody = append([]openapi.Param{
+		{Name: "key", Description: "视频源 key，只能包含字母、数字、_ 和 -", Required: true, MaxLength: 32},
+	}, sourceBody...)
+
+	createUserBody = []openapi.Param{
+		{Name: "username", Description: "用户名，只能包含字母、数字和 _ . -", Required: true, MaxLength: 32},
+		{Name: "password", Description: "密码，至少 6 位", Required: true, MaxLength: 72},
+		{Name: "admin", Type: openapi.Boolean, Description: "是否为管理员"},
+	}
+
+	resetPasswordBody = []openapi.Param{
+		{Name: "password", Description: "新密码，至少 6 位", Required: true, MaxLength: 72},
+	}
+)
+
+// 校验查询参数，不通过时返回 400 并结束请求
+func checkQuery(c *gin.Context, params []openapi.Param) bool {
+	err := openapi.CheckQuery(c.Request.URL.Query(), params)
+	if err == nil {
+		return true
+	}
+	failParam(c, err)
+	return false
+}
+
+// 校验 JSON 请求体后解析到 out，不通过时返回 400 并结束请求
+func bindBody(c *gin.Context, params []openapi.Param, out any) bool {
+	body, err := c.GetRawData()
+	if err != nil {
+		Fail(c, validationError("读取请求体失败"), nil)
+		return false
+	}
+	if err := openapi.CheckBody(body, params); err != nil {
+		failParam(c, err)
+		return false
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		Fail(c, newError(CodeValidation, err, "请求格式错误"), nil)
+		return false
+	}
+	return true
+}
+
+func failParam(c *gin.Context, err error) {
+	var paramErr *openapi.ParamError
+	if !errors.As(err, &paramErr) {
+		Fail(c, err, nil)
+		return
+	}
+	log.Warn().
+		Str("path", c.FullPath()).
+		Str("param", paramErr.Name).
+		Str("value", paramErr.Value).
+		Msg(paramErr.Reason)
+	Fail(c, validationError("%s", paramErr.Error()), gin.H{"param": paramErr.Name, "value": paramErr.Value})
+}
+
+// ============ 接口文档 ============
+
+// 以下类型只用于描述接口返回
+
+// 列表返回
+type listData[T any] struct {
+	List  []T `json:"list"`
+	Total int `json:"total"`
+}
+
+// 按档案隔离的接口在 extra 中返回当前档案
+type profileExtra struct {
+	Profile string `json:"profile"`
+}
+
+type deletedCount struct {
+	Deleted int `json:"deleted"`
+}
+
+type sourceTestExtra struct {
+	Test *sourceTestResult `json:"test,omitempty"`
+}
+
+type gateData struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"` // 毫秒时间戳
+}
+
+type loginData struct {
+	Token     string      `json:"token"`
+	ExpiresAt int64       `json:"expires_at"` // 毫秒时间戳
+	User      models.User `json:"user"`
+}
+
+var (
+	apiDocOnce sync.Once
+	apiDoc     []byte
+)
+
+// OpenAPI 接口文档（OpenAPI 3.0），根据 Go 类型生成
+func OpenAPI(c *gin.Context) {
+	apiDocOnce.Do(func() {
+		var err error
+		apiDoc, err = json.Marshal(buildAPIDoc(conf.Get().APIPath()).Document())
+		if err != nil {
+			log.Error().Err(err).Msg("生成接口文档失败")
+		}
+	})
+	c.Data(http.StatusOK, "application/json; charset=utf-8", apiDoc)
+}
+
+// 接口列表，新增或修改路由时同步更新
+func buildAPIDoc(server string) *openapi.Spec {
+	spec := openapi.New(openapi.Info{
+		Title:       "YTV API",
+		Version:     "1.0.0",
+		Description: "设置了访问密码时，除健康检查和访问密码接口外都需要 X-Access-Token 请求头或 Cookie",
+	}, server, Response{})
+	spec.Security("gate", openapi.SecurityScheme{Type: "apiKey", In: "header", Name: "X-Access-Token", Description: "访问密码令牌"})
+	spec.Security("user", openapi.SecurityScheme{Type: "http", Scheme: "bearer", Description: "登录后返回的 Token"})
+	spec.Security("admin", openapi.SecurityScheme{Type: "http", Scheme: "bearer", Description: "管理员账号登录后返回的 Token，普通用户返回 403"})
+
+	user, admin := []string{"user"}, []string{"admin"}
+
+	spec.Add(
+		openapi.Route{Method: http.MethodGet, Path: "/health", Tag: "系统", Summary: "健康检查",
+			Data: struct {
+				Status string `json:"status"`
+			}{}},
+		openapi.Route{Method: http.MethodGet, Path: "/openapi.json", Tag: "系统", Summary: "接口文档"},
+
+		// 访问密码
+		openapi.Route{Method: http.MethodPost, Path: "/gate/login", Tag: "访问密码", Summary: "输入访问密码",
+			Body: gateLoginRequest{}, Data: gateData{}},
+		openapi.Route{Method: http.MethodPost, Path: "/gate/logout", Tag: "访问密码", Summary: "退出"},
+
+		// 查询
+		openapi.Route{Method: http.MethodGet, Path: "/search", Tag: "查询", Summary: "关键词搜索（所有视频源）",
+			Query: searchQuery, Data: models.SearchData{}, Extra: models.SearchExtra{}},
+		openapi.Route{Method: http.MethodGet, Path: "/vod", Tag: "查询", Summary: "视频详情",
+			Query: vodQuery, Data: models.VodItem{}, Extra: models.DetailExtra{}},
+		openapi.Route{Method: http.MethodGet, Path: "/hot", Tag: "查询", Summary: "豆瓣热门",
+			Query: hotQuery, Data: DoubanRespReturn{}, Extra: map[string]string{}},
+
+		// 播放记录
+		openapi.Route{Method: http.MethodGet, Path: "/history", Tag: "播放记录", Summary: "播放记录列表",
+			Data: listData[models.PlayHistory]{}, Extra: profileExtra{}},
+		openapi.Route{Method: http.MethodPost, Path: "/history", Tag: "播放记录", Summary: "保存播放记录",
+			Body: models.PlayHistory{}, BodyFields: historyBody, Data: models.PlayHistory{}, Extra: profileExtra{}},
+		openapi.Route{Method: http.MethodPost, Path: "/history/sync", Tag: "播放记录", Summary: "同步本地播放记录",
+			Body: syncHistoryRequest{}, BodyFields: syncHistoryBody, Data: listData[models.PlayHistory]{}, Extra: profileExtra{}},
+		openapi.Route{Method: http.MethodDelete, Path: "/history", Tag: "播放记录", Summary: "删除指定视频的播放记录",
+			Query: deleteHistoryQuery, Data: deletedCount{}, Extra: profileExtra{}},
+		openapi.Route{Method: http.MethodDelete, Path: "/history/all", Tag: "播放记录", Summary: "清空播放记录",
+			Data: deletedCount{}, Extra: profileExtra{}},
+
+		// 收藏与追剧
+		openapi.Route{Method: http.MethodGet, Path: "/follows", Tag: "收藏", Summary: "收藏列表",
+			Data: listData[models.Follow]{}, Extra: profileExtra{}},
+		openapi.Route{Method: http.MethodPost, Path: "/follows", Tag: "收藏", Summary: "添加收藏或追剧",
+			Body: models.Follow{}, BodyFields: followBody, Data: models.Follow{}, Extra: profileExtra{}},
+		openapi.Route{Method: http.MethodDelete, Path: "/follows", Tag: "收藏", Summary: "删除收藏",
+			Query: deleteFollowQuery, Data: struct {
+				Deleted bool `json:"deleted"`
+			}{}, Extra: profileExtra{}},
+		openapi.Route{Method: http.MethodGet, Path: "/follows/updates", Tag: "收藏", Summary: "追剧更新列表",
+			Query: []openapi.Param{{Name: "all", Type: openapi.Boolean, Description: "是否包含已读", Default: "false"}},
+			Data:  listData[models.FollowUpdate]{}, Extra: profileExtra{}},
+		openapi.Route{Method: http.MethodPost, Path: "/follows/updates/read", Tag: "收藏", Summary: "标记更新为已读",
+			Body: readUpdatesRequest{}, BodyFields: readUpdatesBody, Data: struct {
+				Read int `json:"read"`
+			}{}, Extra: profileExtra{}},
+
+		// 账号
+		openapi.Route{Method: http.MethodPost, Path: "/auth/register", Tag: "账号", Summary: "注册",
+			Body: credentials{}, Data: loginData{}},
+		openapi.Route{Method: http.MethodPost, Path: "/auth/login", Tag: "账号", Summary: "登录",
+			Body: credentials{}, Data: loginData{}},
+		openapi.Route{Method: http.MethodPost, Path: "/auth/logout", Tag: "账号", Summary: "注销"},
+		openapi.Route{Method: http.MethodGet, Path: "/auth/me", Tag: "账号", Summary: "当前用户", Security: user,
+			Data: models.User{}, Extra: struct {
+				Profile models.Profile `json:"profile"`
+			}{}},
+		openapi.Route{Method: http.MethodPut, Path: "/auth/password", Tag: "账号", Summary: "修改密码", Security: user,
+			Body: changePasswordRequest{}},
+
+		// 档案
+		openapi.Route{Method: http.MethodGet, Path: "/profiles", Tag: "档案", Summary: "档案列表", Security: user,
+			Data: listData[models.Profile]{}},
+		openapi.Route{Method: http.MethodPost, Path: "/profiles", Tag: "档案", Summary: "新建档案", Security: user,
+			Body: models.Profile{}, Data: models.Profile{}},
+		openapi.Route{Method: http.MethodPut, Path: "/profiles/:id", Tag: "档案", Summary: "修改档案", Security: user,
+			Body: models.Profile{}, Data: models.Profile{}},
+		openapi.Route{Method: http.MethodDelete, Path: "/profiles/:id", Tag: "档案", Summary: "删除档案", Security: user},
+
+		// 缓存管理
+		openapi.Route{Method: http.MethodGet, Path: "/admin/cache", Tag: "管理", Summary: "缓存统计", Security: admin,
+			Data: map[string]any{}},
+		openapi.Route{Method: http.MethodGet, Path: "/admin/cache/keys", Tag: "管理", Summary: "缓存条目列表", Security: admin,
+			Query: []openapi.Param{
+				{Name: "type", Description: "缓存类型", Enum: []string{"search", "id", "hot"}},
+				{Name: "q", Description: "按 key 过滤"},
+			},
+			Data: listData[cache.KeyInfo]{}},
+		openapi.Route{Method: http.MethodDelete, Path: "/admin/cache/key", Tag: "管理", Summary: "删除缓存条目", Security: admin,
+			Query: []openapi.Param{{Name: "key", Description: "缓存 key", Required: true}},
+			Data: struct {
+				Deleted bool `json:"deleted"`
+			}{}},
+		openapi.Route{Method: http.MethodDelete, Path: "/admin/cache/:type", Tag: "管理", Summary: "清空指定类型的缓存（all 为全部）", Security: admin,
+			Data: struct {
+				Cleared int `json:"cleared"`
+			}{}},
+		openapi.Route{Method: http.MethodPost, Path: "/admin/cache/refresh/search", Tag: "管理", Summary: "强制刷新关键词搜索缓存", Security: admin,
+			Query: searchQuery, Data: models.SearchData{}, Extra: models.SearchExtra{}},
+		openapi.Route{Method: http.MethodPost, Path: "/admin/cache/refresh/vod", Tag: "管理", Summary: "强制刷新 ID 查询缓存", Security: admin,
+			Query: refreshVodQuery, Data: models.VodItem{}, Extra: models.DetailExtra{}},
+		openapi.Route{Method: http.MethodPost, Path: "/admin/cache/refresh/hot", Tag: "管理", Summary: "强制刷新热门缓存", Security: admin,
+			Query: hotQuery, Data: DoubanRespReturn{}, Extra: map[string]string{}},
+
+		// 视频源管理
+		openapi.Route{Method: http.MethodGet, Path: "/admin/sources", Tag: "管理", Summary: "视频源列表", Security: admin,
+			Data: listData[sourceInfo]{}},
+		openapi.Route{Method: http.MethodPost, Path: "/admin/sources", Tag: "管理", Summary: "新增视频源", Security: admin,
+			Query: []openapi.Param{{Name: "force", Type: openapi.Boolean, Description: "跳过测试查询"}},
+			Body:  createSourceRequest{}, BodyFields: createSourceBody, Data: sourceInfo{}, Extra: sourceTestExtra{}},
+		openapi.Route{Method: http.MethodPut, Path: "/admin/sources/:key", Tag: "管理", Summary: "修改视频源", Security: admin,
+			Query: []openapi.Param{{Name: "force", Type: openapi.Boolean, Description: "跳过测试查询"}},
+			Body:  models.VideoSource{}, BodyFields: sourceBody, Data: sourceInfo{}, Extra: sourceTestExtra{}},
+		openapi.Route{Method: http.MethodDelete, Path: "/admin/sources/:key", Tag: "管理", Summary: "删除视频源", Security: admin},
+		openapi.Route{Method: http.MethodPost, Path: "/admin/sources/:key/enable", Tag: "管理", Summary: "启用视频源", Security: admin,
+			Data: sourceInfo{}},
+		openapi.Route{Method: http.MethodPost, Path: "/admin/sources/:key/disable", Tag: "管理", Summary: "停用视频源", Security: admin,
+			Data: sourceInfo{}},
+		openapi.Route{Method: http.MethodPost, Path: "/admin/sources/:key/test", Tag: "管理", Summary: "测试视频源", Security: admin,
+			Query: []openapi.Param{{Name: "wd", Description: "测试关键词"}},
+			Data:  sourceTestResult{}},
+
+		// Webhook 管理
+		openapi.Route{Method: http.MethodGet, Path: "/admin/webhooks", Tag: "管理", Summary: "Webhook 列表", Security: admin,
+			Data: listData[models.Webhook]{}},
+		openapi.Route{Method: http.MethodGet, Path: "/admin/webhooks/deliveries", Tag: "管理", Summary: "最近的推送记录", Security: admin,
+			Data: listData[webhook.Delivery]{}},
+		openapi.Route{Method: http.MethodPost, Path: "/admin/webhooks/:name/test", Tag: "管理", Summary: "测试 Webhook", Security: admin,
+			Data: webhook.Delivery{}},
+
+		// 用户管理
+		openapi.Route{Method: http.MethodGet, Path: "/users", Tag: "用户管理", Summary: "用户列表", Security: admin,
+			Data: listData[models.User]{}},
+		openapi.Route{Method: http.MethodPost, Path: "/users", Tag: "用户管理", Summary: "创建用户", Security: admin,
+			Body: createUserRequest{}, BodyFields: createUserBody, Data: models.User{}},
+		openapi.Route{Method: http.MethodDelete, Path: "/users/:id", Tag: "用户管理", Summary: "删除用户", Security: admin},
+		openapi.Route{Method: http.MethodPut, Path: "/users/:id/password", Tag: "用户管理", Summary: "重置用户密码", Security: admin,
+			Body: resetPasswordRequest{}, BodyFields: resetPasswordBody},
+	)
+	return spec
+}
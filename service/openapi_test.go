@@ -0,0 +1,77 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIDocSecurity(t *testing.T) {
+	doc := buildAPIDoc("/api/v1").Document()
+
+	if _, ok := doc.Components.SecuritySchemes["admin"]; !ok {
+		t.Fatal("缺少 admin 认证方式")
+	}
+	security := func(method, path string) []string {
+		var names []string
+		for _, req := range doc.Paths[path][method].Security {
+			for name := range req {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	if got := security("get", "/users"); !slices.Equal(got, []string{"admin"}) {
+		t.Errorf("/users security = %v, want [admin]", got)
+	}
+	if got := security("get", "/auth/me"); !slices.Equal(got, []string{"user"}) {
+		t.Errorf("/auth/me security = %v, want [user]", got)
+	}
+
+	body := doc.Paths["/history"]["post"].RequestBody.Content["application/json"].Schema
+	if len(body.AllOf) != 2 || !slices.Contains(body.AllOf[1].Required, "sourceKey") {
+		t.Errorf("/history 请求体缺少字段约束: %+v", body)
+	}
+}
+
+func TestSaveHistoryValidatesBody(t *testing.T) {
+	loadTestConfig(t, "")
+
+	r := gin.New()
+	r.POST("/history", SaveHistory)
+	post := func(body string) (int, Response) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/history", strings.NewReader(body)))
+		var resp Response
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	tests := []struct {
+		name  string
+		body  string
+		param string
+	}{
+		{"missing source", `{"vod_id":1}`, "sourceKey"},
+		{"string vod_id", `{"sourceKey":"test","vod_id":"1"}`, "vod_id"},
+		{"negative progress", `{"sourceKey":"test","vod_id":1,"progress":-3}`, "progress"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := post(tt.body)
+			extra, _ := resp.Extra.(map[string]any)
+			if code != http.StatusBadRequest || resp.ErrorCode != CodeValidation || extra["param"] != tt.param {
+				t.Errorf("got %d %+v, want 400 on %s", code, resp, tt.param)
+			}
+		})
+	}
+
+	if code, resp := post(`{"sourceKey":"test","vod_id":1,"episode_index":2,"progress":30.5}`); code != http.StatusOK {
+		t.Errorf("合法请求返回 %d %+v", code, resp)
+	}
+}
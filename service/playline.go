@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"tv/conf"
+	"tv/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 多条播放线路之间的分隔符
+const playLineSep = "$$$"
+
+// 解析播放线路：vod_play_from 与 vod_play_url 均以 $$$ 分隔，按位置一一对应
+func parsePlayLines(playFrom, playURL string) []models.PlayLine {
+	if playURL == "" {
+		return nil
+	}
+
+	names := strings.Split(playFrom, playLineSep)
+	urls := strings.Split(playURL, playLineSep)
+
+	lines := make([]models.PlayLine, 0, len(urls))
+	for i, u := range urls {
+		episodes := normalizeEpisodes(parseVodPlayURL(u))
+		if len(episodes) == 0 {
+			continue
+		}
+
+		name := ""
+		if i < len(names) {
+			name = strings.TrimSpace(names[i])
+		}
+		if name == "" {
+			name = fmt.Sprintf("线路%d", i+1)
+		}
+
+		lines = append(lines, models.PlayLine{Name: name, Episodes: episodes})
+	}
+	return lines
+}
+
+// 按优先级选择播放线路，并将其剧集设置为 item.Episodes
+// 优先匹配 prefer 中的线路名称（忽略大小写），其次选择 m3u8 直链线路，最后选择第一条
+func selectPlayLine(item *models.VodItem, prefer []string) bool {
+	if len(item.PlayLines) == 0 {
+		return false
+	}
+
+	idx := -1
+	for _, name := range prefer {
+		for i, line := range item.PlayLines {
+			if strings.EqualFold(line.Name, name) {
+				idx = i
+				break
+			}
+		}
+		if idx >= 0 {
+			break
+		}
+	}
+
+	if idx < 0 {
+		for i, line := range item.PlayLines {
+			if isPlaylist(line.Episodes[0].URL) {
+				idx = i
+				break
+			}
+		}
+	}
+
+	if idx < 0 {
+		idx = 0
+	}
+
+	item.PlayLine = item.PlayLines[idx].Name
+	item.Episodes = item.PlayLines[idx].Episodes
+	return true
+}
+
+// 搜索结果只保留各线路的名称，当前线路的剧集已在 Episodes 中，其他线路的剧集在详情中返回
+func stripPlayLines(items []models.VodItem) []models.VodItem {
+	for i := range items {
+		lines := make([]models.PlayLine, len(items[i].PlayLines))
+		for j, line := range items[i].PlayLines {
+			lines[j] = models.PlayLine{Name: line.Name}
+		}
+		items[i].PlayLines = lines
+	}
+	return items
+}
+
+// ============ Handler 辅助 ============
+
+// 根据请求参数 line 选择详情结果的播放线路，并在 extra 中返回当前线路和所有可选线路
+func chooseDetailLine(c *gin.Context, data any, extra any) (any, any) {
+	item, ok := data.(models.VodItem)
+	if !ok || len(item.PlayLines) == 0 {
+		return data, extra
+	}
+
+	if line := c.Query("line"); line != "" {
+		prefer := append([]string{line}, conf.Get().Play.PreferLines...)
+		selectPlayLine(&item, prefer)
+	}
+
+	names := make([]string, len(item.PlayLines))
+	for i, line := range item.PlayLines {
+		names[i] = line.Name
+	}
+
+	newExtra := copyExtra(extra)
+	newExtra["play_line"] = item.PlayLine
+	newExtra["play_lines"] = names
+
+	return item, newExtra
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"testing"
+	"tv/models"
+)
+
+func TestStripPlayLines(t *testing.T) {
+	item := models.VodItem{VodID: 1}
+	item.PlayLines = parsePlayLines("线路A$$$m3u8", "第1集$http://a/1.mp4#第2集$http://a/2.mp4$$$第1集$http://b/1.m3u8")
+	selectPlayLine(&item, nil)
+
+	items := stripPlayLines([]models.VodItem{item})
+
+	got := items[0]
+	if len(got.PlayLines) != 2 || got.PlayLines[0].Name != "线路A" || got.PlayLines[1].Name != "m3u8" {
+		t.Fatalf("PlayLines = %+v", got.PlayLines)
+	}
+	for _, line := range got.PlayLines {
+		if line.Episodes != nil {
+			t.Errorf("线路 %s 仍带有剧集", line.Name)
+		}
+	}
+	// 当前线路的剧集仍在 Episodes 中
+	if got.PlayLine != "m3u8" || len(got.Episodes) != 1 || got.Episodes[0].URL != "http://b/1.m3u8" {
+		t.Errorf("PlayLine = %s, Episodes = %+v", got.PlayLine, got.Episodes)
+	}
+}
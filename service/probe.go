@@ -0,0 +1,323 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"tv/conf"
+	"tv/models"
+	"tv/upstream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var episodeProber = NewEpisodeProber()
+
+// 最多缓存的检测结果数，超出时淘汰最早的结果
+const maxProbeResults = 4096
+
+// 单个链接的检测结果
+type probeResult struct {
+	available bool
+	latency   int64
+	err       string
+	expiresAt time.Time
+}
+
+// EpisodeProber 剧集链接检测器
+type EpisodeProber struct {
+	client *resty.Client
+
+	mu      sync.RWMutex
+	results map[string]probeResult
+}
+
+// NewEpisodeProber 检测请求与访问视频源一样按主机限速，并按配置走代理
+func NewEpisodeProber() *EpisodeProber {
+	c := resty.New().
+		SetHeader("User-Agent", "Mozilla/5.0 (compatible; VideoAPI/1.0)")
+	c.SetTransport(upstream.Transport())
+	return &EpisodeProber{
+		client:  c,
+		results: make(map[string]probeResult),
+	}
+}
+
+// ProbeEpisodes 并发检测剧集链接，返回带检测结果的新切片（不修改原切片）
+// ctx 取消（客户端断开）后不再发起新的检测，未检测的剧集没有检测结果
+func (p *EpisodeProber) ProbeEpisodes(ctx context.Context, episodes []models.Episode) []models.Episode {
+	out := make([]models.Episode, len(episodes))
+	copy(out, episodes)
+
+	concurrency := conf.Get().Probe.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i := range out {
+		if !isProbeable(out[i].URL) {
+			continue
+		}
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			r, ok := p.probe(ctx, out[idx].URL)
+			if !ok {
+				return
+			}
+			available := r.available
+			out[idx].Available = &available
+			out[idx].ProbeLatency = r.latency
+			out[idx].ProbeError = r.err
+		}(i)
+	}
+	wg.Wait()
+
+	return out
+}
+
+// 检测单个链接（优先读取缓存），ctx 取消时返回 false，不缓存结果
+func (p *EpisodeProber) probe(ctx context.Context, rawURL string) (probeResult, bool) {
+	now := time.Now()
+
+	p.mu.RLock()
+	cached, ok := p.results[rawURL]
+	p.mu.RUnlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached, true
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, conf.Get().Probe.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := p.check(checkCtx, rawURL, 0)
+	if ctx.Err() != nil {
+		return probeResult{}, false
+	}
+	result := probeResult{
+		available: err == nil,
+		latency:   time.Since(start).Milliseconds(),
+		expiresAt: time.Now().Add(conf.Get().Probe.TTL),
+	}
+	if err != nil {
+		result.err = err.Error()
+		log.Debug().
+			Str("url", rawURL).
+			Err(err).
+			Int64("duration_ms", result.latency).
+			Msg("剧集链接不可用")
+	}
+
+	p.mu.Lock()
+	p.results[rawURL] = result
+	p.evict(now)
+	p.mu.Unlock()
+
+	return result, true
+}
+
+// 结果过多时先清理过期项，仍然过多时按检测时间淘汰最早的结果（调用方需持有锁）
+// 一次淘汰到上限的 3/4，避免缓存已满后每次写入都要排序
+func (p *EpisodeProber) evict(now time.Time) {
+	if len(p.results) <= maxProbeResults {
+		return
+	}
+	for k, r := range p.results {
+		if now.After(r.expiresAt) {
+			delete(p.results, k)
+		}
+	}
+	if len(p.results) <= maxProbeResults {
+		return
+	}
+
+	keys := make([]string, 0, len(p.results))
+	for k := range p.results {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return p.results[keys[i]].expiresAt.Before(p.results[keys[j]].expiresAt)
+	})
+	for _, k := range keys[:len(keys)-maxProbeResults*3/4] {
+		delete(p.results, k)
+	}
+}
+
+// 检测链接：m3u8 需能解析出片段并访问第一个片段，其他链接只检查状态码
+func (p *EpisodeProber) check(ctx context.Context, rawURL string, depth int) error {
+	if !isPlaylist(rawURL) {
+		return p.checkResource(ctx, rawURL)
+	}
+
+	resp, err := p.client.R().SetContext(ctx).Get(rawURL)
+	if err != nil {
+		return fmt.Errorf("请求播放列表失败: %v", err)
+	}
+	if resp.StatusCode() != 200 {
+		return fmt.Errorf("播放列表 HTTP 状态码 %d", resp.StatusCode())
+	}
+
+	body := strings.TrimSpace(resp.String())
+	if !strings.HasPrefix(body, "#EXTM3U") {
+		return fmt.Errorf("不是有效的 m3u8 播放列表")
+	}
+
+	// 第一个非注释行即第一个子列表或片段
+	isMaster := strings.Contains(body, "#EXT-X-STREAM-INF")
+	var first string
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			first = line
+			break
+		}
+	}
+	if first == "" {
+		return fmt.Errorf("播放列表为空")
+	}
+
+	next, err := resolveURL(rawURL, first)
+	if err != nil {
+		return fmt.Errorf("解析片段地址失败: %v", err)
+	}
+
+	if isMaster {
+		if depth >= 2 {
+			return fmt.Errorf("播放列表嵌套过深")
+		}
+		return p.check(ctx, next, depth+1)
+	}
+	return p.checkResource(ctx, next)
+}
+
+// 只请求资源的开头部分，避免下载整个文件
+func (p *EpisodeProber) checkResource(ctx context.Context, rawURL string) error {
+	resp, err := p.client.R().
+		SetContext(ctx).
+		SetHeader("Range", "bytes=0-1023").
+		SetDoNotParseResponse(true).
+		Get(rawURL)
+	if err != nil {
+		return fmt.Errorf("请求片段失败: %v", err)
+	}
+	resp.RawBody().Close()
+
+	if code := resp.StatusCode(); code != 200 && code != 206 {
+		return fmt.Errorf("片段 HTTP 状态码 %d", code)
+	}
+	return nil
+}
+
+// ============ Handler 辅助 ============
+
+// 根据配置和请求参数对详情结果执行链接检测
+// probe=true/false 覆盖 probe.enabled，hideBroken=true/false 覆盖 probe.hide_broken
+// 检测会向播放地址发出大量请求，未登录时不能通过 probe=true 开启检测
+func probeDetail(c *gin.Context, data any, extra any) (any, any) {
+	enabled := conf.Get().Probe.Enabled
+	if v, ok := c.GetQuery("probe"); ok {
+		if _, loggedIn := currentUser(c); loggedIn || v != "true" {
+			enabled = v == "true"
+		}
+	}
+	if !enabled {
+		return data, extra
+	}
+
+	item, ok := data.(models.VodItem)
+	if !ok {
+		return data, extra
+	}
+
+	hide := conf.Get().Probe.HideBroken
+	if v, ok := c.GetQuery("hideBroken"); ok {
+		hide = v == "true"
+	}
+
+	start := time.Now()
+	episodes := episodeProber.ProbeEpisodes(c.Request.Context(), item.Episodes)
+
+	checked, broken := 0, 0
+	kept := make([]models.Episode, 0, len(episodes))
+	for _, ep := range episodes {
+		if ep.Available != nil {
+			checked++
+			if !*ep.Available {
+				broken++
+				if hide {
+					continue
+				}
+			}
+		}
+		kept = append(kept, ep)
+	}
+	item.Episodes = kept
+
+	log.Info().
+		Str("source_key", item.SourceKey).
+		Int("vod_id", item.VodID).
+		Int("checked", checked).
+		Int("broken", broken).
+		Int64("duration_ms", time.Since(start).Milliseconds()).
+		Msg("剧集链接检测完成")
+
+	newExtra := copyExtra(extra)
+	newExtra["probe"] = gin.H{
+		"checked": checked,
+		"broken":  broken,
+		"hidden":  hide,
+	}
+
+	return item, newExtra
+}
+
+// ====== 工具函数 =======
+
+// 只检测直链（m3u8 / mp4 等），跳过网页播放地址
+func isProbeable(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	path := strings.ToLower(u.Path)
+	return strings.HasSuffix(path, ".m3u8") || strings.HasSuffix(path, ".mp4")
+}
+
+func isPlaylist(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+}
+
+// 将播放列表中的相对地址转换为绝对地址
+func resolveURL(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
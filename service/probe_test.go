@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tv/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestProberEvictsOldest(t *testing.T) {
+	p := NewEpisodeProber()
+	now := time.Now()
+	for i := 0; i <= maxProbeResults; i++ {
+		p.results[fmt.Sprint(i)] = probeResult{expiresAt: now.Add(time.Duration(i+1) * time.Second)}
+	}
+
+	p.evict(now)
+
+	if got, want := len(p.results), maxProbeResults*3/4; got != want {
+		t.Fatalf("len = %d, want %d", got, want)
+	}
+	if _, ok := p.results["0"]; ok {
+		t.Error("最早的结果未被淘汰")
+	}
+	if _, ok := p.results[fmt.Sprint(maxProbeResults)]; !ok {
+		t.Error("最新的结果被淘汰")
+	}
+}
+
+func TestProberPrunesExpiredFirst(t *testing.T) {
+	p := NewEpisodeProber()
+	now := time.Now()
+	for i := 0; i <= maxProbeResults; i++ {
+		expiresAt := now.Add(time.Minute)
+		if i%2 == 0 {
+			expiresAt = now.Add(-time.Minute)
+		}
+		p.results[fmt.Sprint(i)] = probeResult{expiresAt: expiresAt}
+	}
+
+	p.evict(now)
+
+	if got, want := len(p.results), maxProbeResults/2; got != want {
+		t.Fatalf("len = %d, want %d", got, want)
+	}
+}
+
+func TestProbeDetailRequiresLogin(t *testing.T) {
+	loadTestConfig(t, "probe:\n  timeout: 1s\n")
+
+	item := models.VodItem{
+		SourceKey: "test",
+		VodID:     1,
+		Episodes:  []models.Episode{{EpisodeTitle: "第1集", URL: "http://127.0.0.1:1/1.m3u8"}},
+	}
+	probed := func(user *models.User) bool {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/detail?probe=true", nil)
+		if user != nil {
+			c.Set(ctxUserKey, *user)
+		}
+		_, extra := probeDetail(c, item, gin.H{})
+		_, ok := extra.(gin.H)["probe"]
+		return ok
+	}
+
+	if probed(nil) {
+		t.Error("未登录时 probe=true 不应开启检测")
+	}
+	if !probed(&models.User{ID: "u1", Username: "alice"}) {
+		t.Error("登录用户 probe=true 应开启检测")
+	}
+}
+
+func TestProbeStopsWhenClientLeaves(t *testing.T) {
+	loadTestConfig(t, "probe:\n  concurrency: 1\n  timeout: 5s\n")
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	episodes := make([]models.Episode, 3)
+	for i := range episodes {
+		episodes[i] = models.Episode{URL: fmt.Sprintf("%s/%d.mp4", srv.URL, i)}
+	}
+
+	p := NewEpisodeProber()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for requests.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	start := time.Now()
+	out := p.ProbeEpisodes(ctx, episodes)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ProbeEpisodes took %s after the client left", elapsed)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("server received %d requests, want 1", n)
+	}
+	for i, ep := range out {
+		if ep.Available != nil {
+			t.Errorf("episode %d has a probe result after cancel", i)
+		}
+	}
+	if len(p.results) != 0 {
+		t.Errorf("cancelled probes cached: %v", p.results)
+	}
+}
@@ -1,17 +1,21 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
 )
 
 // 统一返回结构
 type Response struct {
-	Code    int         `json:"code"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-	Extra   interface{} `json:"extra,omitempty"`
+	Code      int         `json:"code"`
+	ErrorCode ErrorCode   `json:"error_code,omitempty"` // 出错时的错误类型
+	Message   string      `json:"message"`
+	Data      interface{} `json:"data,omitempty"`
+	Extra     interface{} `json:"extra,omitempty"`
 }
 
 // 成功返回
@@ -24,11 +28,68 @@ func Success(c *gin.Context, data interface{}, extra interface{}) {
 	})
 }
 
-// 错误返回
+// 错误返回，code 同时作为 HTTP 状态码（不是 4xx/5xx 时按 500 返回）
 func Error(c *gin.Context, code int, message string, extra interface{}) {
-	c.JSON(http.StatusInternalServerError, Response{
-		Code:    code,
-		Message: message,
-		Extra:   extra,
+	status := code
+	if status < 400 || status > 599 {
+		status = http.StatusInternalServerError
+	}
+	c.JSON(status, Response{
+		Code:      code,
+		ErrorCode: codeForStatus(status),
+		Message:   message,
+		Extra:     extra,
+	})
+}
+
+// 客户端关闭连接（沿用 nginx 的约定），只用于日志和指标
+const statusClientClosed = 499
+
+// Fail 按错误类型返回对应的 HTTP 状态码和错误码，非 APIError 视为内部错误
+func Fail(c *gin.Context, err error, extra interface{}) {
+	// 客户端已断开，返回内容不会被接收
+	if errors.Is(err, context.Canceled) && c.Request.Context().Err() != nil {
+		c.AbortWithStatus(statusClientClosed)
+		return
+	}
+
+	code := CodeInternal
+	status := http.StatusInternalServerError
+	message := "服务器内部错误"
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		code = apiErr.Code
+		status = apiErr.Status()
+		message = apiErr.Message
+	}
+
+	// 原始错误可能包含上游地址等内部信息，只写入日志
+	event := log.Warn()
+	if status >= http.StatusInternalServerError {
+		event = log.Error()
+	}
+	event.Ctx(c.Request.Context()).
+		Err(err).
+		Str("path", c.FullPath()).
+		Str("error_code", string(code)).
+		Int("status", status).
+		Msg("请求失败")
+
+	c.JSON(status, Response{
+		Code:      status,
+		ErrorCode: code,
+		Message:   message,
+		Extra:     extra,
 	})
 }
+
+// 复制 extra，避免修改缓存中的数据
+func copyExtra(extra interface{}) gin.H {
+	out := gin.H{}
+	if m, ok := extra.(gin.H); ok {
+		for k, v := range m {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -1,20 +1,25 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 	"tv/cache"
 	"tv/conf"
+	"tv/metrics"
 	"tv/models"
+	"tv/tracing"
+	"tv/upstream"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cast"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var videoAPI = NewVideoAPI()
@@ -27,6 +32,8 @@ func NewVideoAPI() *VideoAPI {
 	c := resty.New().
 		SetTimeout(5*time.Second).
 		SetHeader("User-Agent", "Mozilla/5.0 (compatible; VideoAPI/1.0)")
+	// 视频源和 Omo 页面的请求按主机限速，并按配置走代理
+	c.SetTransport(upstream.Transport())
 	return &VideoAPI{client: c}
 }
 
@@ -51,41 +58,56 @@ type sourceResult struct {
 }
 
 // 从单个源获取数据
-func (api *VideoAPI) fetchFromSource(sourceKey string, source models.VideoSource, params map[string]string) sourceResult {
+func (api *VideoAPI) fetchFromSource(ctx context.Context, sourceKey string, source models.VideoSource, params map[string]string) sourceResult {
 	start := time.Now()
 	result := sourceResult{SourceKey: sourceKey, SourceName: source.Name}
+	ctx, span := tracing.Start(ctx, "source.fetch",
+		attribute.String("source.key", sourceKey),
+		attribute.String("source.name", source.Name),
+		attribute.String("source.ac", params["ac"]),
+	)
+	defer func() {
+		metrics.ObserveUpstream(sourceKey, time.Since(start), result.Error)
+		span.SetAttributes(attribute.Int("source.items", len(result.Items)))
+		tracing.End(span, result.Error)
+	}()
 
-	log.Debug().
+	log.Debug().Ctx(ctx).
 		Str("source", sourceKey).
 		Str("api", source.API).
 		Fields(params).
 		Msg("开始请求视频源")
 
-	resp, err := api.client.R().SetQueryParams(params).Get(source.API)
+	resp, err := api.client.R().SetContext(ctx).SetQueryParams(params).Get(source.API)
 	if err != nil {
-		result.Error = fmt.Errorf("请求失败: %v", err)
+		result.Error = upstreamError(err, "请求失败")
 		result.Duration = time.Since(start).Milliseconds()
 
-		log.Error().
+		log.Error().Ctx(ctx).
 			Str("source", sourceKey).
 			Err(err).
 			Int64("duration_ms", result.Duration).
 			Msg("请求视频源失败")
 
+		recordSourceResult(sourceKey, source.Name, result.Error)
 		return result
 	}
 
 	var apiResp videoAPIResponse
 	if err := json.Unmarshal(resp.Body(), &apiResp); err != nil {
-		result.Error = fmt.Errorf("解析 JSON 失败: %v", err)
+		result.Error = upstreamParseError(err, "解析 JSON 失败")
+		if resp.IsError() {
+			result.Error = upstreamStatusError(resp.StatusCode())
+		}
 		result.Duration = time.Since(start).Milliseconds()
 
-		log.Error().
+		log.Error().Ctx(ctx).
 			Str("source", sourceKey).
 			Err(err).
 			Int64("duration_ms", result.Duration).
 			Msg("解析视频源响应失败")
 
+		recordSourceResult(sourceKey, source.Name, result.Error)
 		return result
 	}
 
@@ -93,109 +115,152 @@ func (api *VideoAPI) fetchFromSource(sourceKey string, source models.VideoSource
 	for i, item := range apiResp.List {
 		item.SourceKey = sourceKey
 		item.SourceName = source.Name
-		item.Episodes = parseVodPlayURL(item.VodPlayURL)
+		item.PlayLines = parsePlayLines(item.VodPlayFrom, item.VodPlayURL)
+		selectPlayLine(&item, conf.Get().Play.PreferLines)
 		result.Items[i] = item
 	}
 	result.Duration = time.Since(start).Milliseconds()
 
-	log.Debug().
+	log.Debug().Ctx(ctx).
 		Str("source", sourceKey).
 		Int("items", len(result.Items)).
 		Int64("duration_ms", result.Duration).
 		Msg("视频源请求完成")
 
+	recordSourceResult(sourceKey, source.Name, nil)
 	return result
 }
 
-// 并行抓取多个源
-func (api *VideoAPI) fetchParallel(sources map[string]models.VideoSource, fetcher func(string, models.VideoSource) sourceResult) []sourceResult {
-	var wg sync.WaitGroup
-	resultChan := make(chan sourceResult, len(sources))
-
+// 关键词搜索使用的视频源：启用的非成人源，Omo 只在第一页参与搜索
+func searchSources(cfg *conf.Config, page string) map[string]models.VideoSource {
+	sources := cfg.GetActiveVideoSources()
 	for key, source := range sources {
-		if strings.EqualFold(source.Name, "omo") {
-			continue
+		if isOmoSource(source) {
+			delete(sources, key)
 		}
-		wg.Add(1)
-		go func(k string, s models.VideoSource) {
-			defer wg.Done()
-			resultChan <- fetcher(k, s)
-		}(key, source)
 	}
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-
-	var results []sourceResult
-	for r := range resultChan {
-		results = append(results, r)
+	if omo, ok := cfg.GetVideoSource("omo"); ok && (page == "1" || page == "") {
+		sources["omo"] = omo
 	}
-	return results
+	return sources
 }
 
 // 搜索关键词
-func (api *VideoAPI) SearchByKeyword(keyword, page string, includeAdult bool) (any, any, error) {
+// 每个源的结果单独缓存，只请求未命中缓存的源，再合并为一个响应
+// 超过 search.deadline 时先返回已完成的源，未完成的源在 extra.pending_sources 中列出，
+// 它们的请求继续在后台执行并写入缓存，再次搜索即可拿到完整结果
+func (api *VideoAPI) SearchByKeyword(ctx context.Context, keyword, page string, includeAdult bool) (any, any, error) {
+	ctx, span := tracing.Start(ctx, "search.keyword",
+		attribute.String("search.keyword", keyword),
+		attribute.String("search.page", page),
+	)
+	defer span.End()
+
 	start := time.Now()
-	sources := conf.Cfg.GetActiveVideoSources()
+	cfg := conf.Get()
+	sources := searchSources(cfg, page)
+	cacher := cache.GetCacher()
 
-	log.Info().
+	log.Info().Ctx(ctx).
 		Str("keyword", keyword).
 		Str("page", page).
 		Bool("adult", includeAdult).
 		Int("sources", len(sources)).
 		Msg("开始关键词搜索")
 
+	defer metrics.FanoutStarted()()
+
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 
 	all := make([]models.VodItem, 0)
 	successCount := 0
 	failedCount := 0
+	staleSources := make([]string, 0)
+	pending := make(map[string]bool, len(sources))
+	for key := range sources {
+		pending[key] = true
+	}
+	finished := false // 已返回响应，之后完成的源只写入缓存
 
-	// 1. 获取原有数据源
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		results := api.fetchParallel(sources, func(key string, s models.VideoSource) sourceResult {
-			params := map[string]string{"ac": "videolist", "wd": keyword, "pg": page}
-			return api.fetchFromSource(key, s, params)
-		})
-
-		mu.Lock()
-		defer mu.Unlock()
-		for _, r := range results {
-			if r.Error == nil {
-				successCount++
-				all = append(all, r.Items...)
-			} else {
-				failedCount++
-			}
-		}
-	}()
+	// 超过搜索时限后请求不随本次请求结束而取消；客户端在时限前断开时取消全部请求
+	fetchCtx, cancelFetch := context.WithCancel(context.WithoutCancel(ctx))
 
-	// 2. 获取 Omo 数据
-	_, ok := conf.Cfg.GetVideoSource("omo")
-	if (page == "1" || page == "") && ok {
+	for key, source := range sources {
 		wg.Add(1)
-		go func() {
+		go func(key string, source models.VideoSource) {
 			defer wg.Done()
 
-			result := api.SearchOmo(keyword)
+			params := cache.SearchParams{SourceKey: key, Keyword: keyword, Page: page}
+			entry := cacher.FetchSearch(fetchCtx, params, func(ctx context.Context) ([]models.VodItem, error) {
+				var result sourceResult
+				if key == "omo" {
+					result = api.SearchOmo(ctx, keyword)
+				} else {
+					result = api.fetchFromSource(ctx, key, source, map[string]string{"ac": "videolist", "wd": keyword, "pg": page})
+				}
+				return stripPlayLines(result.Items), result.Error
+			})
 
 			mu.Lock()
 			defer mu.Unlock()
-
-			if result.Error == nil {
-				successCount++
-				all = append(all, result.Items...)
-			} else {
+			delete(pending, key)
+			if finished {
+				log.Debug().Ctx(ctx).
+					Str("keyword", keyword).
+					Str("source", key).
+					Str("error", entry.Error).
+					Int64("duration_ms", time.Since(start).Milliseconds()).
+					Msg("搜索时限后完成的视频源，结果已写入缓存")
+				return
+			}
+			if entry.Error != "" {
 				failedCount++
+				return
+			}
+			successCount++
+			all = append(all, entry.Items...)
+			if entry.Stale {
+				staleSources = append(staleSources, key)
 			}
-		}()
+		}(key, source)
 	}
 
-	wg.Wait()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		cancelFetch()
+		close(done)
+	}()
+
+	var deadline <-chan time.Time
+	if cfg.Search.Deadline > 0 {
+		timer := time.NewTimer(cfg.Search.Deadline)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	select {
+	case <-done:
+	case <-deadline:
+	case <-ctx.Done():
+		// 客户端已断开，尚未完成的视频源请求随之取消，不再组合结果
+		cancelFetch()
+		log.Info().Ctx(ctx).
+			Str("keyword", keyword).
+			Int64("duration_ms", time.Since(start).Milliseconds()).
+			Msg("客户端已断开，关键词搜索取消")
+		return nil, nil, ctx.Err()
+	}
+
+	mu.Lock()
+	finished = true
+	pendingSources := make([]string, 0, len(pending))
+	for key := range pending {
+		pendingSources = append(pendingSources, key)
+	}
+	mu.Unlock()
+	sort.Strings(pendingSources)
 
 	omoItems := make([]models.VodItem, 0, len(all))
 	otherItems := make([]models.VodItem, 0, len(all))
@@ -213,12 +278,21 @@ func (api *VideoAPI) SearchByKeyword(keyword, page string, includeAdult bool) (a
 
 	all = append(omoItems, otherItems...)
 
+	span.SetAttributes(
+		attribute.Int("search.success", successCount),
+		attribute.Int("search.failed", failedCount),
+		attribute.Int("search.stale", len(staleSources)),
+		attribute.Int("search.pending", len(pendingSources)),
+	)
+
 	duration := time.Since(start).Milliseconds()
-	log.Info().
+	log.Info().Ctx(ctx).
 		Str("keyword", keyword).
 		Str("page", page).
 		Int("success", successCount).
 		Int("failed", failedCount).
+		Int("stale", len(staleSources)).
+		Strs("pending", pendingSources).
 		Int("total_items", len(all)).
 		Int64("duration_ms", duration).
 		Msg("关键词搜索完成")
@@ -229,44 +303,61 @@ func (api *VideoAPI) SearchByKeyword(keyword, page string, includeAdult bool) (a
 		"page":          page,
 		"success_count": successCount,
 		"failed_count":  failedCount,
-		"total_sources": len(sources) + 1, // +1 for Omo
+		"total_sources": successCount + failedCount + len(pendingSources),
+	}
+	if len(staleSources) > 0 {
+		sort.Strings(staleSources)
+		extra["stale"] = true
+		extra["stale_sources"] = staleSources
+	}
+	if len(pendingSources) > 0 {
+		extra["partial"] = true
+		extra["pending_sources"] = pendingSources
 	}
 	return data, extra, nil
 }
 
+// 删除关键词搜索在各视频源的缓存结果
+func forgetKeyword(keyword, page string) {
+	cacher := cache.GetCacher()
+	for key := range searchSources(conf.Get(), page) {
+		cacher.DeleteSearch(cache.SearchParams{SourceKey: key, Keyword: keyword, Page: page})
+	}
+}
+
 // 根据ID搜索
-func (api *VideoAPI) SearchByID(sourceKey string, vodID int, index int) (any, any, error) {
+func (api *VideoAPI) SearchByID(ctx context.Context, sourceKey string, vodID int, index int) (any, any, error) {
 	start := time.Now()
 
-	log.Info().
+	log.Info().Ctx(ctx).
 		Str("source_key", sourceKey).
 		Int("vod_id", vodID).
 		Msg("开始 ID 搜索")
 
 	var result sourceResult
 
-	source, ok := conf.Cfg.GetVideoSource(sourceKey)
+	source, ok := conf.Get().GetVideoSource(sourceKey)
 	if !ok {
-		log.Warn().
+		log.Warn().Ctx(ctx).
 			Str("source_key", sourceKey).
 			Int("vod_id", vodID).
 			Msg("视频源不存在")
-		return nil, gin.H{"source_key": sourceKey, "vod_id": vodID}, fmt.Errorf("视频源不存在")
+		return nil, gin.H{"source_key": sourceKey, "vod_id": vodID}, notFoundError("视频源不存在")
 	}
 
 	// 判断是否为 Omo 源
 	if strings.EqualFold(source.Name, "omo") {
-		result = api.GetOmoDetail(vodID, index)
+		result = api.GetOmoDetail(ctx, vodID, index)
 	} else {
 		// 普通视频源
 		params := map[string]string{"ac": "videolist", "ids": strconv.Itoa(vodID)}
-		result = api.fetchFromSource(sourceKey, source, params)
+		result = api.fetchFromSource(ctx, sourceKey, source, params)
 	}
 
 	duration := time.Since(start).Milliseconds()
 
 	if result.Error != nil {
-		log.Error().
+		log.Error().Ctx(ctx).
 			Str("source_key", sourceKey).
 			Int("vod_id", vodID).
 			Err(result.Error).
@@ -276,15 +367,15 @@ func (api *VideoAPI) SearchByID(sourceKey string, vodID int, index int) (any, an
 	}
 
 	if len(result.Items) == 0 {
-		log.Warn().
+		log.Warn().Ctx(ctx).
 			Str("source_key", sourceKey).
 			Int("vod_id", vodID).
 			Int64("duration_ms", duration).
 			Msg("ID 搜索无结果")
-		return nil, nil, fmt.Errorf("没有查到相关信息")
+		return nil, nil, notFoundError("没有查到相关信息")
 	}
 
-	log.Info().
+	log.Info().Ctx(ctx).
 		Str("source_key", sourceKey).
 		Str("source_name", source.Name).
 		Int("vod_id", vodID).
@@ -302,12 +393,10 @@ func (api *VideoAPI) SearchByID(sourceKey string, vodID int, index int) (any, an
 func SearchVideoAPI(c *gin.Context) {
 	log.Info().Msg("处理视频关键词搜索请求")
 
-	keyword := c.Query("wd")
-	if keyword == "" {
-		log.Warn().Msg("请求参数 'wd' (关键词) 不能为空")
-		Error(c, 400, "搜索关键词不能为空", nil)
+	if !checkQuery(c, searchQuery) {
 		return
 	}
+	keyword := c.Query("wd")
 	page := c.DefaultQuery("pg", "1")
 	includeAdult := c.DefaultQuery("adult", "false") == "true"
 
@@ -317,50 +406,22 @@ func SearchVideoAPI(c *gin.Context) {
 		Bool("adult", includeAdult).
 		Msg("请求参数解析成功")
 
-	// 获取缓存
-	cacheKey := cache.SearchParams{
-		Keyword:      keyword,
-		Page:         page,
-		IncludeAdult: includeAdult,
-	}
-	cacher := cache.GetCacher()
-	res, ok := cacher.GetKeyword(cacheKey)
-	if ok {
-		log.Info().
-			Str("keyword", keyword).
-			Str("page", page).
-			Msg("关键词搜索请求命中缓存")
-		Success(c, res.Data, res.Extra)
-		return
-	}
-	log.Debug().
-		Str("keyword", keyword).
-		Str("page", page).
-		Msg("关键词搜索请求未命中缓存，将调用后端服务")
-
-	data, extra, err := videoAPI.SearchByKeyword(keyword, page, includeAdult)
+	// 各视频源的结果在 SearchByKeyword 中分别读取缓存
+	data, extra, err := videoAPI.SearchByKeyword(c.Request.Context(), keyword, page, includeAdult)
 	if err != nil {
 		log.Error().
 			Str("keyword", keyword).
 			Str("page", page).
 			Err(err).
 			Msg("调用 SearchByKeyword 失败")
-		Error(c, 500, err.Error(), extra)
+		Fail(c, err, extra)
 		return
 	}
 
-	// 缓存结果的日志，可以放在 cacher.SetKeyword 之后或之前
-	cacher.SetKeyword(cacheKey, models.APIResponse{
-		Code:    0,
-		Message: "",
-		Data:    data,
-		Extra:   extra,
-	})
-	log.Debug().
-		Str("keyword", keyword).
-		Str("page", page).
-		Msg("关键词搜索结果已存入缓存")
-
+	// 部分视频源未完成时不允许浏览器缓存，再次请求可以拿到完整结果
+	if e, ok := extra.(gin.H); ok && e["partial"] == true {
+		c.Header("Cache-Control", "no-store")
+	}
 	Success(c, data, extra)
 	log.Info().
 		Str("keyword", keyword).
@@ -371,39 +432,12 @@ func SearchVideoAPI(c *gin.Context) {
 func SearchVideoById(c *gin.Context) {
 	log.Info().Msg("处理视频 ID 搜索请求")
 
-	sourceKey := c.Query("sourceKey")
-	if sourceKey == "" {
-		log.Warn().Msg("请求参数 'sourceKey' 不能为空")
-		Error(c, 400, "sourceKey不能为空", nil)
-		return
-	}
-	vodIDStr := c.Query("vodId")
-	if vodIDStr == "" {
-		log.Warn().
-			Str("source_key", sourceKey).
-			Msg("请求参数 'vodId' 不能为空")
-		Error(c, 400, "vodId不能为空", nil)
+	if !checkQuery(c, vodQuery) {
 		return
 	}
+	sourceKey := c.Query("sourceKey")
+	vodID, _ := strconv.Atoi(c.Query("vodId"))
 	episodeIndexStr := c.Query("episodeIndex")
-	if episodeIndexStr == "" {
-		log.Warn().
-			Str("source_key", sourceKey).
-			Msg("请求参数 'episodeIndex' 不能为空")
-		Error(c, 400, "episodeIndex不能为空", nil)
-		return
-	}
-
-	vodID, err := strconv.Atoi(vodIDStr)
-	if err != nil {
-		log.Warn().
-			Str("source_key", sourceKey).
-			Str("vod_id_str", vodIDStr).
-			Err(err).
-			Msg("请求参数 'vodId' 格式错误")
-		Error(c, 400, "vodId 格式错误", vodIDStr)
-		return
-	}
 
 	log.Debug().
 		Str("source_key", sourceKey).
@@ -416,44 +450,22 @@ func SearchVideoById(c *gin.Context) {
 		VodID:     vodID,
 		Index:     episodeIndexStr,
 	}
-	cacher := cache.GetCacher()
-	res, ok := cacher.GetByID(cacheKey)
-	if ok {
-		log.Info().
-			Str("source_key", sourceKey).
-			Int("vod_id", vodID).
-			Msg("ID 搜索请求命中缓存")
-		Success(c, res.Data, res.Extra)
-		return
-	}
-	log.Debug().
-		Str("source_key", sourceKey).
-		Int("vod_id", vodID).
-		Msg("ID 搜索请求未命中缓存，将调用后端服务")
-
-	data, extra, err := videoAPI.SearchByID(sourceKey, vodID, cast.ToInt(episodeIndexStr))
+	// 读取缓存，未命中时调用后端；相同参数的并发请求只调用一次，结果由 FetchByID 存入缓存
+	res, err := cache.GetCacher().FetchByID(c.Request.Context(), cacheKey, func(ctx context.Context) (models.APIResponse, error) {
+		data, extra, err := videoAPI.SearchByID(ctx, sourceKey, vodID, cast.ToInt(episodeIndexStr))
+		return models.APIResponse{Data: data, Extra: extra}, err
+	})
 	if err != nil {
 		log.Error().
 			Str("source_key", sourceKey).
 			Int("vod_id", vodID).
 			Err(err).
 			Msg("调用 SearchByID 失败")
-		Error(c, 500, err.Error(), extra)
+		Fail(c, err, res.Extra)
 		return
 	}
 
-	// 缓存结果的日志
-	cacher.SetByID(cacheKey, models.APIResponse{
-		Code:    0,
-		Message: "",
-		Data:    data,
-		Extra:   extra,
-	})
-	log.Debug().
-		Str("source_key", sourceKey).
-		Int("vod_id", vodID).
-		Msg("ID 搜索结果已存入缓存")
-
+	data, extra := decorateDetail(c, res.Data, res.Extra, cast.ToInt(episodeIndexStr))
 	Success(c, data, extra)
 	// --- 【补充点 8：请求成功日志】 ---
 	log.Info().
@@ -462,6 +474,14 @@ func SearchVideoById(c *gin.Context) {
 		Msg("ID 搜索请求处理完成并成功返回")
 }
 
+// 对详情结果依次执行：选择播放线路、计算下一集、检测链接
+// 缓存中保存的是未处理的原始结果，因此命中缓存时同样需要调用
+func decorateDetail(c *gin.Context, data any, extra any, index int) (any, any) {
+	data, extra = chooseDetailLine(c, data, extra)
+	data, extra = attachNextEpisode(data, extra, index)
+	return probeDetail(c, data, extra)
+}
+
 // ====== 工具函数 =======
 // 解析播放URL
 func parseVodPlayURL(playURL string) []models.Episode {
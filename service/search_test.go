@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tv/cache"
+	"tv/conf"
+	"tv/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 模拟的视频源接口，每次返回一条与源同名的结果
+type fakeSource struct {
+	*httptest.Server
+	calls atomic.Int32
+	fail  atomic.Bool
+	delay time.Duration
+}
+
+func newFakeSource(t *testing.T, name string, delay time.Duration) *fakeSource {
+	t.Helper()
+	s := &fakeSource{delay: delay}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.calls.Add(1)
+		select {
+		case <-time.After(s.delay):
+		case <-r.Context().Done():
+			return
+		}
+		if s.fail.Load() {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, `{"code":1,"list":[{"vod_id":1,"vod_name":%q,"vod_play_from":"line","vod_play_url":"第1集$http://example.com/%s.m3u8"}]}`, name, name)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func sourcesYAML(sources map[string]*fakeSource) string {
+	yaml := "sources:\n"
+	for name, s := range sources {
+		yaml += fmt.Sprintf("  %s:\n    api: %q\n    name: %q\n", name, s.URL, name)
+	}
+	return yaml
+}
+
+// 清空搜索缓存并设置搜索结果和失败结果的缓存时间，测试结束后恢复
+func setSearchTTL(t *testing.T, ttl, negative time.Duration) {
+	t.Helper()
+	cacher := cache.GetCacher()
+	cacher.Clear(cache.CacheTypeSearch)
+	cfg := conf.Get()
+	set := func(search, negative time.Duration) {
+		cacher.SetTTL(map[cache.CacheType]time.Duration{
+			cache.CacheTypeSearch: search,
+			cache.CacheTypeID:     cfg.Cache.ID,
+			cache.CacheTypeHot:    cfg.Cache.Hot,
+		}, map[cache.CacheType]time.Duration{})
+		cacher.SetNegativeTTL(negative)
+	}
+	set(ttl, negative)
+	t.Cleanup(func() { set(cfg.Cache.Search, cfg.Cache.Negative) })
+}
+
+func search(t *testing.T, keyword string) ([]models.VodItem, gin.H) {
+	t.Helper()
+	data, extra, err := videoAPI.SearchByKeyword(context.Background(), keyword, "1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data.(gin.H)["list"].([]models.VodItem), extra.(gin.H)
+}
+
+func namesOf(items []models.VodItem) map[string]bool {
+	names := make(map[string]bool)
+	for _, item := range items {
+		names[item.VodName] = true
+	}
+	return names
+}
+
+func TestSearchRetriesOnlyFailedSources(t *testing.T) {
+	good := newFakeSource(t, "good", 0)
+	bad := newFakeSource(t, "bad", 0)
+	bad.fail.Store(true)
+	loadTestConfig(t, sourcesYAML(map[string]*fakeSource{"good": good, "bad": bad}))
+	setSearchTTL(t, time.Minute, 100*time.Millisecond)
+	const keyword = "retry-failed-sources"
+
+	items, extra := search(t, keyword)
+	if names := namesOf(items); !names["good"] || names["bad"] || extra["failed_count"] != 1 {
+		t.Fatalf("first search = %v, extra = %v", names, extra)
+	}
+
+	// 失败结果在 cache.negative 内命中缓存，两个源都不再请求
+	search(t, keyword)
+	if good.calls.Load() != 1 || bad.calls.Load() != 1 {
+		t.Fatalf("calls = %d, %d, want 1, 1", good.calls.Load(), bad.calls.Load())
+	}
+
+	// 失败结果过期后只重新请求失败的源，成功的源仍从缓存组合
+	bad.fail.Store(false)
+	time.Sleep(120 * time.Millisecond)
+	items, extra = search(t, keyword)
+	if names := namesOf(items); !names["good"] || !names["bad"] || extra["success_count"] != 2 {
+		t.Errorf("search after negative TTL = %v, extra = %v", names, extra)
+	}
+	if good.calls.Load() != 1 || bad.calls.Load() != 2 {
+		t.Errorf("calls = %d, %d, want 1, 2", good.calls.Load(), bad.calls.Load())
+	}
+}
+
+func TestSearchDeadlineReturnsPartial(t *testing.T) {
+	fast := newFakeSource(t, "fast", 0)
+	slow := newFakeSource(t, "slow", 200*time.Millisecond)
+	loadTestConfig(t, "search:\n  deadline: 50ms\n"+sourcesYAML(map[string]*fakeSource{"fast": fast, "slow": slow}))
+	setSearchTTL(t, time.Minute, time.Minute)
+	const keyword = "deadline-partial"
+
+	start := time.Now()
+	items, extra := search(t, keyword)
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("search took %s, want about the 50ms deadline", elapsed)
+	}
+	if names := namesOf(items); !names["fast"] || names["slow"] {
+		t.Errorf("partial list = %v", names)
+	}
+	if extra["partial"] != true || !reflect.DeepEqual(extra["pending_sources"], []string{"slow"}) || extra["total_sources"] != 2 {
+		t.Errorf("partial extra = %v", extra)
+	}
+
+	// 慢的源在后台继续请求并写入缓存，再次搜索拿到完整结果
+	deadline := time.Now().Add(2 * time.Second)
+	for extra["partial"] == true {
+		if time.Now().After(deadline) {
+			t.Fatal("slow source never reached the cache")
+		}
+		time.Sleep(20 * time.Millisecond)
+		items, extra = search(t, keyword)
+	}
+	if names := namesOf(items); !names["fast"] || !names["slow"] || extra["success_count"] != 2 {
+		t.Errorf("complete list = %v, extra = %v", names, extra)
+	}
+	// 后续的搜索与后台请求合并或命中缓存，每个源只请求一次
+	if fast.calls.Load() != 1 || slow.calls.Load() != 1 {
+		t.Errorf("calls = %d, %d, want 1, 1", fast.calls.Load(), slow.calls.Load())
+	}
+}
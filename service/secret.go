@@ -0,0 +1,52 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"tv/conf"
+	"tv/store"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	secretKey  []byte
+	secretOnce sync.Once
+)
+
+// 服务端签名密钥，首次使用时随机生成并保存到 data_dir/secret.key
+// 删除该文件后之前签发的设备标识全部失效
+func serverSecret() []byte {
+	secretOnce.Do(func() {
+		path := filepath.Join(conf.Get().App.DataDir, "secret.key")
+		data, err := os.ReadFile(path)
+		if err == nil && len(strings.TrimSpace(string(data))) >= 32 {
+			secretKey = []byte(strings.TrimSpace(string(data)))
+			return
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error().Err(err).Str("path", path).Msg("读取签名密钥失败，使用临时密钥")
+		}
+
+		secretKey = []byte(randomID(32))
+		if err := store.WriteFile(path, secretKey); err != nil {
+			log.Error().Err(err).Str("path", path).Msg("保存签名密钥失败，重启后签名将失效")
+			return
+		}
+		log.Info().Str("path", path).Msg("已生成签名密钥")
+	})
+	return secretKey
+}
+
+// 用服务端密钥对 payload 签名，purpose 区分不同用途，避免签名被挪用
+func signWithSecret(purpose, payload string) string {
+	mac := hmac.New(sha256.New, serverSecret())
+	mac.Write([]byte(purpose + ":" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
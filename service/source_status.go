@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"tv/upstream"
+	"tv/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// 连续失败次数达到该值时认为视频源故障
+const sourceDownThreshold = 3
+
+type sourceStatus struct {
+	failures  int
+	down      bool
+	lastError string
+}
+
+var (
+	sourceStatusMu sync.Mutex
+	sourceStatuses = make(map[string]*sourceStatus)
+)
+
+// 记录视频源请求结果：连续失败达到阈值时推送 source.down，故障后首次成功推送 source.up
+// 客户端断开或服务退出导致的取消不计入失败
+func recordSourceResult(sourceKey, sourceName string, err error) {
+	// 请求被取消或在本地限速排队时超时，上游并未失败
+	if errors.Is(err, context.Canceled) || upstream.IsLimited(err) {
+		return
+	}
+
+	sourceStatusMu.Lock()
+	status, ok := sourceStatuses[sourceKey]
+	if !ok {
+		status = &sourceStatus{}
+		sourceStatuses[sourceKey] = status
+	}
+
+	event := ""
+	if err != nil {
+		status.failures++
+		status.lastError = err.Error()
+		if !status.down && status.failures >= sourceDownThreshold {
+			status.down = true
+			event = webhook.EventSourceDown
+		}
+	} else {
+		if status.down {
+			event = webhook.EventSourceUp
+		}
+		status.failures = 0
+		status.down = false
+		status.lastError = ""
+	}
+	failures, lastError := status.failures, status.lastError
+	sourceStatusMu.Unlock()
+
+	if event == "" {
+		return
+	}
+
+	log.Warn().
+		Str("source", sourceKey).
+		Str("event", event).
+		Int("failures", failures).
+		Msg("视频源状态变化")
+
+	webhook.Emit(event, gin.H{
+		"source_key":  sourceKey,
+		"source_name": sourceName,
+		"failures":    failures,
+		"last_error":  lastError,
+		"changed_at":  time.Now().UnixMilli(),
+	})
+}
+
+// 视频源当前的健康状态
+func sourceStatusOf(sourceKey string) sourceStatus {
+	sourceStatusMu.Lock()
+	defer sourceStatusMu.Unlock()
+	if status, ok := sourceStatuses[sourceKey]; ok {
+		return *status
+	}
+	return sourceStatus{}
+}
+
+// 删除视频源后清理其状态
+func forgetSourceStatus(sourceKey string) {
+	sourceStatusMu.Lock()
+	defer sourceStatusMu.Unlock()
+	delete(sourceStatuses, sourceKey)
+}
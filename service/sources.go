@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"sort"
+	"strings"
+	"tv/cache"
+	"tv/conf"
+	"tv/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// 视频源信息（管理接口）
+type sourceInfo struct {
+	Key string `json:"key"`
+	models.VideoSource
+	Down      bool   `json:"down"`
+	Failures  int    `json:"failures"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+type createSourceRequest struct {
+	Key string `json:"key"`
+	models.VideoSource
+}
+
+// 视频源测试结果
+type sourceTestResult struct {
+	OK       bool   `json:"ok"`
+	Items    int    `json:"items"`
+	Duration int64  `json:"duration_ms"`
+	Error    string `json:"error,omitempty"`
+}
+
+func isOmoSource(source models.VideoSource) bool {
+	return strings.EqualFold(source.Name, "omo")
+}
+
+// 校验请求中的视频源字段
+func validateSource(source *models.VideoSource) error {
+	source.API = strings.TrimSpace(source.API)
+	source.Name = strings.TrimSpace(source.Name)
+	source.Detail = strings.TrimSpace(source.Detail)
+	source.Proxy = strings.TrimSpace(source.Proxy)
+
+	if source.Name == "" {
+		return errors.New("视频源名称不能为空")
+	}
+	u, err := url.Parse(source.API)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("api 必须是 http(s) 地址")
+	}
+	if source.RateLimit < 0 || source.Burst < 0 {
+		return errors.New("rate_limit 和 burst 不能为负数")
+	}
+	if !conf.ValidProxy(source.Proxy) {
+		return errors.New("proxy 必须是 http(s)、socks5(h) 地址或 direct")
+	}
+	return nil
+}
+
+// 对视频源发起一次测试查询：普通源请求最新列表（可用 wd 指定关键词），Omo 源按关键词搜索
+func testSource(ctx context.Context, key string, source models.VideoSource, keyword string) sourceTestResult {
+	var result sourceResult
+	if isOmoSource(source) {
+		if keyword == "" {
+			return sourceTestResult{Error: "Omo 源测试需要指定关键词 wd"}
+		}
+		result = videoAPI.SearchOmo(ctx, keyword)
+	} else {
+		params := map[string]string{"ac": "videolist", "pg": "1"}
+		if keyword != "" {
+			params["wd"] = keyword
+		}
+		result = videoAPI.fetchFromSource(ctx, key, source, params)
+	}
+
+	test := sourceTestResult{Items: len(result.Items), Duration: result.Duration}
+	switch {
+	case result.Error != nil:
+		test.Error = result.Error.Error()
+	case len(result.Items) == 0 && keyword == "":
+		test.Error = "未返回任何视频"
+	default:
+		test.OK = true
+	}
+	return test
+}
+
+// 修改视频源后清空该源的搜索缓存，使新的源配置立即生效
+func sourcesChanged(key, action string) {
+	ApplyUpstream(conf.Get())
+	count := cache.GetCacher().ClearSearchSource(key)
+	log.Info().
+		Str("source", key).
+		Str("action", action).
+		Int("cleared", count).
+		Msg("视频源已变更，清空该源的搜索缓存")
+}
+
+func sourceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, conf.ErrSourceNotFound):
+		abortWithStatus(c, 404, err.Error())
+	case errors.Is(err, conf.ErrSourceExists):
+		abortWithStatus(c, 409, err.Error())
+	default:
+		// 读写配置文件的错误包含服务器路径，只记录日志
+		Fail(c, err, nil)
+	}
+}
+
+// ============ Handler ============
+
+// 视频源列表（包含已停用的源和健康状态）
+func ListSources(c *gin.Context) {
+	sources := conf.Get().GetAllVideoSources()
+	list := make([]sourceInfo, 0, len(sources))
+	for key, source := range sources {
+		status := sourceStatusOf(key)
+		list = append(list, sourceInfo{
+			Key:         key,
+			VideoSource: source,
+			Down:        status.down,
+			Failures:    status.failures,
+			LastError:   status.lastError,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+	Success(c, gin.H{"list": list, "total": len(list)}, nil)
+}
+
+// 新增视频源，保存前先发起测试查询，force=true 时跳过测试
+func CreateSource(c *gin.Context) {
+	var req createSourceRequest
+	if !bindBody(c, createSourceBody, &req) {
+		return
+	}
+	if !conf.ValidSourceKey(req.Key) {
+		Error(c, 400, "key 只能包含字母、数字、_ 和 -，长度 1-32", req.Key)
+		return
+	}
+	saveSource(c, req.Key, req.VideoSource, true)
+}
+
+// 修改视频源，规则同新增
+func UpdateSource(c *gin.Context) {
+	key := c.Param("key")
+	var source models.VideoSource
+	if !bindBody(c, sourceBody, &source) {
+		return
+	}
+	saveSource(c, key, source, false)
+}
+
+func saveSource(c *gin.Context, key string, source models.VideoSource, create bool) {
+	if err := validateSource(&source); err != nil {
+		Error(c, 400, err.Error(), nil)
+		return
+	}
+	sources := maps.Clone(conf.Get().Sources)
+	sources[key] = source
+	if err := conf.SourceProxyConflicts(sources); err != nil {
+		Error(c, 400, err.Error(), nil)
+		return
+	}
+
+	var test *sourceTestResult
+	if c.Query("force") != "true" && !isOmoSource(source) {
+		result := testSource(c.Request.Context(), key, source, c.Query("wd"))
+		if !result.OK {
+			log.Warn().Str("source", key).Str("error", result.Error).Msg("视频源测试失败，未保存")
+			Error(c, 400, fmt.Sprintf("视频源测试失败: %s", result.Error), gin.H{"test": result})
+			return
+		}
+		test = &result
+	}
+
+	var err error
+	if create {
+		err = conf.CreateSource(key, source)
+	} else {
+		err = conf.UpdateSource(key, source)
+	}
+	if err != nil {
+		sourceError(c, err)
+		return
+	}
+
+	sourcesChanged(key, "save")
+	Success(c, sourceInfo{Key: key, VideoSource: source}, gin.H{"test": test})
+}
+
+// 启用视频源
+func EnableSource(c *gin.Context) {
+	setSourceDisabled(c, false)
+}
+
+// 停用视频源
+func DisableSource(c *gin.Context) {
+	setSourceDisabled(c, true)
+}
+
+func setSourceDisabled(c *gin.Context, disabled bool) {
+	key := c.Param("key")
+	source, ok := conf.Get().GetAllVideoSources()[key]
+	if !ok {
+		abortWithStatus(c, 404, conf.ErrSourceNotFound.Error())
+		return
+	}
+
+	source.Disabled = disabled
+	if err := conf.UpdateSource(key, source); err != nil {
+		sourceError(c, err)
+		return
+	}
+
+	action := "enable"
+	if disabled {
+		action = "disable"
+	}
+	sourcesChanged(key, action)
+	Success(c, sourceInfo{Key: key, VideoSource: source}, nil)
+}
+
+// 测试视频源，参数 wd 指定测试关键词
+func TestSource(c *gin.Context) {
+	key := c.Param("key")
+	source, ok := conf.Get().GetAllVideoSources()[key]
+	if !ok {
+		abortWithStatus(c, 404, conf.ErrSourceNotFound.Error())
+		return
+	}
+
+	log.Info().Str("source", key).Msg("测试视频源")
+	Success(c, testSource(c.Request.Context(), key, source, c.Query("wd")), gin.H{"key": key})
+}
+
+// 删除视频源
+func DeleteSource(c *gin.Context) {
+	key := c.Param("key")
+	if err := conf.DeleteSource(key); err != nil {
+		sourceError(c, err)
+		return
+	}
+
+	forgetSourceStatus(key)
+	sourcesChanged(key, "delete")
+	Success(c, nil, gin.H{"key": key})
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"net/url"
+	"sort"
+	"tv/conf"
+	"tv/upstream"
+
+	"github.com/rs/zerolog/log"
+)
+
+// 豆瓣和 Omo 的主机，使用 upstream.douban / upstream.omofun 的限速和 proxy.douban / proxy.omofun 的代理
+var (
+	doubanHosts = []string{"movie.douban.com"}
+	omofunHosts = []string{"www.omofun.link", "omofun.link"}
+)
+
+// ApplyUpstream 按配置设置各上游主机的限速和代理，启动、配置热加载和修改视频源后调用
+func ApplyUpstream(cfg *conf.Config) {
+	applyLimits(cfg)
+	applyProxies(cfg)
+}
+
+func applyLimits(cfg *conf.Config) {
+	limits := make(map[string]upstream.Limit)
+	for _, source := range cfg.Sources {
+		if source.RateLimit == 0 && source.Burst == 0 {
+			continue
+		}
+		host := sourceHost(source.API)
+		if host == "" {
+			continue
+		}
+		l := upstream.Limit{Rate: source.RateLimit, Burst: source.Burst}
+		if l.Rate == 0 {
+			l.Rate = cfg.Upstream.Sources.Rate
+		}
+		if l.Burst == 0 {
+			l.Burst = cfg.Upstream.Sources.Burst
+		}
+		// 多个源共用主机时取较严格的值
+		if prev, ok := limits[host]; ok {
+			l = stricter(prev, l)
+		}
+		limits[host] = l
+	}
+	for _, host := range doubanHosts {
+		limits[host] = upstream.Limit(cfg.Upstream.Douban)
+	}
+	for _, host := range omofunHosts {
+		limits[host] = upstream.Limit(cfg.Upstream.Omofun)
+	}
+
+	upstream.Configure(limits, upstream.Limit(cfg.Upstream.Sources), cfg.Upstream.MaxWait)
+}
+
+// 速率为 0 表示不限速，视为最宽松
+func stricter(a, b upstream.Limit) upstream.Limit {
+	out := a
+	if b.Rate > 0 && (a.Rate == 0 || b.Rate < a.Rate) {
+		out.Rate = b.Rate
+	}
+	out.Burst = min(a.Burst, b.Burst)
+	return out
+}
+
+// 代理地址已在加载配置时校验，解析失败时保留原设置
+func applyProxies(cfg *conf.Config) {
+	proxies := make(map[string]string)
+	set := func(host, proxy string) {
+		if _, ok := proxies[host]; !ok && host != "" && proxy != "" {
+			proxies[host] = proxy
+		}
+	}
+
+	// 共用主机的源在加载配置时已校验为相同的代理
+	keys := make([]string, 0, len(cfg.Sources))
+	for key := range cfg.Sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		source := cfg.Sources[key]
+		set(sourceHost(source.API), source.Proxy)
+	}
+	for _, host := range doubanHosts {
+		set(host, cfg.Proxy.Douban)
+	}
+	for _, host := range omofunHosts {
+		set(host, cfg.Proxy.Omofun)
+	}
+
+	if err := upstream.ConfigureProxies(proxies, cfg.Proxy.Default); err != nil {
+		log.Error().Err(err).Msg("设置上游代理失败")
+	}
+}
+
+func sourceHost(api string) string {
+	u, err := url.Parse(api)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,386 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"tv/conf"
+	"tv/models"
+	"tv/store"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUserExists      = errors.New("用户名已存在")
+	ErrUserNotFound    = errors.New("用户不存在")
+	ErrProfileNotFound = errors.New("档案不存在")
+	errBadCredentials  = errors.New("用户名或密码错误")
+	errLastAdmin       = errors.New("不能删除最后一个管理员")
+	errLastProfile     = errors.New("至少需要保留一个档案")
+)
+
+var usernameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{2,32}$`)
+
+var (
+	userStore *UserStore
+	userOnce  sync.Once
+)
+
+func GetUserStore() *UserStore {
+	userOnce.Do(func() {
+		userStore = &UserStore{
+			usersPath:    filepath.Join(conf.Get().App.DataDir, "users.json"),
+			sessionsPath: filepath.Join(conf.Get().App.DataDir, "sessions.json"),
+			users:        make(map[string]models.User),
+			sessions:     make(map[string]models.Session),
+		}
+		if err := store.LoadJSON(userStore.usersPath, &userStore.users); err != nil {
+			log.Error().Err(err).Str("path", userStore.usersPath).Msg("加载用户失败")
+		}
+		if err := store.LoadJSON(userStore.sessionsPath, &userStore.sessions); err != nil {
+			log.Error().Err(err).Str("path", userStore.sessionsPath).Msg("加载登录会话失败")
+		}
+
+		userStore.bootstrapAdmin()
+
+		log.Info().
+			Int("users", len(userStore.users)).
+			Int("sessions", len(userStore.sessions)).
+			Msg("用户存储已就绪")
+	})
+	return userStore
+}
+
+// UserStore 保存用户账号和登录会话
+type UserStore struct {
+	sync.RWMutex
+	usersPath    string
+	sessionsPath string
+	users        map[string]models.User    // id -> user
+	sessions     map[string]models.Session // token hash -> session
+}
+
+// 没有任何用户且配置了管理员密码时创建初始管理员
+func (s *UserStore) bootstrapAdmin() {
+	cfg := conf.Get()
+	if len(s.users) > 0 || cfg.Users.AdminPassword == "" {
+		return
+	}
+
+	admin, err := s.Create(cfg.Users.AdminUsername, cfg.Users.AdminPassword, true)
+	if err != nil {
+		log.Error().Err(err).Msg("创建初始管理员失败")
+		return
+	}
+	log.Info().Str("username", admin.Username).Msg("已创建初始管理员")
+}
+
+// ============ 用户 ============
+
+// List 返回所有用户（按创建时间排序）
+func (s *UserStore) List() []models.User {
+	s.RLock()
+	defer s.RUnlock()
+
+	list := make([]models.User, 0, len(s.users))
+	for _, u := range s.users {
+		list = append(list, u.Public())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt < list[j].CreatedAt
+	})
+	return list
+}
+
+// Get 根据 ID 获取用户
+func (s *UserStore) Get(id string) (models.User, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	u, ok := s.users[id]
+	return u, ok
+}
+
+// Create 创建用户，同时创建一个与用户名同名的默认档案
+func (s *UserStore) Create(username, password string, admin bool) (models.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, u := range s.users {
+		if strings.EqualFold(u.Username, username) {
+			return models.User{}, ErrUserExists
+		}
+	}
+
+	u := models.User{
+		ID:           randomID(8),
+		Username:     username,
+		PasswordHash: string(hash),
+		Admin:        admin,
+		Profiles:     []models.Profile{{ID: randomID(4), Name: username}},
+		CreatedAt:    time.Now().UnixMilli(),
+	}
+	s.users[u.ID] = u
+
+	return u, s.saveUsers()
+}
+
+// Delete 删除用户及其登录会话
+func (s *UserStore) Delete(id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if u.Admin && s.adminCount() <= 1 {
+		return errLastAdmin
+	}
+
+	delete(s.users, id)
+	for hash, sess := range s.sessions {
+		if sess.UserID == id {
+			delete(s.sessions, hash)
+		}
+	}
+
+	if err := s.saveUsers(); err != nil {
+		return err
+	}
+	return s.saveSessions()
+}
+
+// SetPassword 修改密码并注销该用户的所有会话
+func (s *UserStore) SetPassword(id, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.PasswordHash = string(hash)
+	s.users[id] = u
+
+	for h, sess := range s.sessions {
+		if sess.UserID == id {
+			delete(s.sessions, h)
+		}
+	}
+
+	if err := s.saveUsers(); err != nil {
+		return err
+	}
+	return s.saveSessions()
+}
+
+// Authenticate 校验用户名和密码
+func (s *UserStore) Authenticate(username, password string) (models.User, error) {
+	s.RLock()
+	var found *models.User
+	for _, u := range s.users {
+		if strings.EqualFold(u.Username, username) {
+			found = &u
+			break
+		}
+	}
+	s.RUnlock()
+
+	// 用户不存在时也比较一次固定的哈希，使两种情况耗时相同，避免通过响应时间判断用户名是否存在
+	if found == nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return models.User{}, errBadCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(found.PasswordHash), []byte(password)); err != nil {
+		return models.User{}, errBadCredentials
+	}
+	return *found, nil
+}
+
+// ============ 档案 ============
+
+// SaveProfile 新增或更新档案（ID 为空时新增）
+func (s *UserStore) SaveProfile(userID string, p models.Profile) (models.Profile, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return models.Profile{}, ErrUserNotFound
+	}
+
+	// 复制切片，避免修改其他请求持有的用户副本
+	profiles := append([]models.Profile(nil), u.Profiles...)
+
+	if p.ID == "" {
+		p.ID = randomID(4)
+		profiles = append(profiles, p)
+	} else {
+		found := false
+		for i := range profiles {
+			if profiles[i].ID == p.ID {
+				profiles[i] = p
+				found = true
+				break
+			}
+		}
+		if !found {
+			return models.Profile{}, ErrProfileNotFound
+		}
+	}
+	u.Profiles = profiles
+	s.users[userID] = u
+
+	return p, s.saveUsers()
+}
+
+// DeleteProfile 删除档案，至少保留一个
+func (s *UserStore) DeleteProfile(userID, profileID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if len(u.Profiles) <= 1 {
+		return errLastProfile
+	}
+
+	profiles := make([]models.Profile, 0, len(u.Profiles))
+	for _, p := range u.Profiles {
+		if p.ID != profileID {
+			profiles = append(profiles, p)
+		}
+	}
+	if len(profiles) == len(u.Profiles) {
+		return ErrProfileNotFound
+	}
+	u.Profiles = profiles
+	s.users[userID] = u
+
+	return s.saveUsers()
+}
+
+// ============ 会话 ============
+
+// CreateSession 创建登录会话，返回明文 Token（只在此时可见）
+func (s *UserStore) CreateSession(userID string) (string, time.Time, error) {
+	token := randomID(32)
+	expiresAt := time.Now().Add(conf.Get().Users.SessionTTL)
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.sessions[hashToken(token)] = models.Session{
+		TokenHash: hashToken(token),
+		UserID:    userID,
+		ExpiresAt: expiresAt.UnixMilli(),
+	}
+	s.cleanSessions()
+
+	return token, expiresAt, s.saveSessions()
+}
+
+// LookupSession 根据 Token 查找用户
+func (s *UserStore) LookupSession(token string) (models.User, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	sess, ok := s.sessions[hashToken(token)]
+	if !ok || time.Now().UnixMilli() > sess.ExpiresAt {
+		return models.User{}, false
+	}
+	u, ok := s.users[sess.UserID]
+	return u, ok
+}
+
+// DeleteSession 注销会话
+func (s *UserStore) DeleteSession(token string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.sessions, hashToken(token))
+	return s.saveSessions()
+}
+
+// 清理过期会话（调用方需持有锁）
+func (s *UserStore) cleanSessions() {
+	now := time.Now().UnixMilli()
+	for h, sess := range s.sessions {
+		if now > sess.ExpiresAt {
+			delete(s.sessions, h)
+		}
+	}
+}
+
+// ============ 持久化 ============
+
+func (s *UserStore) adminCount() int {
+	count := 0
+	for _, u := range s.users {
+		if u.Admin {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *UserStore) saveUsers() error {
+	if err := store.SaveJSON(s.usersPath, s.users); err != nil {
+		log.Error().Err(err).Str("path", s.usersPath).Msg("保存用户失败")
+		return err
+	}
+	return nil
+}
+
+func (s *UserStore) saveSessions() error {
+	if err := store.SaveJSON(s.sessionsPath, s.sessions); err != nil {
+		log.Error().Err(err).Str("path", s.sessionsPath).Msg("保存登录会话失败")
+		return err
+	}
+	return nil
+}
+
+// ====== 工具函数 =======
+
+// 与真实密码使用相同 cost 的哈希，只用于用户不存在时的比较
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte(randomID(16)), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuthenticateTiming(t *testing.T) {
+	loadTestConfig(t, "")
+	s := GetUserStore()
+	if _, err := s.Create("timing-user", "secret123", false); err != nil {
+		t.Fatal(err)
+	}
+	dummyPasswordHash() // 首次调用生成哈希，不计入耗时
+
+	measure := func(username string) time.Duration {
+		start := time.Now()
+		if _, err := s.Authenticate(username, "wrong-password"); err != errBadCredentials {
+			t.Fatalf("Authenticate(%q) error = %v", username, err)
+		}
+		return time.Since(start)
+	}
+
+	existing, missing := measure("timing-user"), measure("nobody")
+	// 用户不存在时同样执行一次 bcrypt 比较，耗时应在同一数量级
+	if missing < existing/4 {
+		t.Errorf("unknown user took %v, existing user %v", missing, existing)
+	}
+
+	if _, err := s.Authenticate("timing-user", "secret123"); err != nil {
+		t.Errorf("correct password rejected: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// 使用内存中的 SpanRecorder 作为全局 TracerProvider
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return recorder
+}
+
+func spanNamed(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, s := range spans {
+		if s.Name() == name {
+			return s
+		}
+	}
+	t.Fatalf("span %q not recorded", name)
+	return nil
+}
+
+func TestMiddlewareCreatesSpans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := recordSpans(t)
+
+	r := gin.New()
+	r.Use(Middleware("ytv-test"))
+	r.GET("/api/v1/vod/:id", func(c *gin.Context) {
+		_, span := Start(c.Request.Context(), "source.fetch")
+		End(span, nil)
+		c.Status(http.StatusOK)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/vod/1", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	spans := recorder.Ended()
+	// Span 名称使用路由模板，未匹配的请求只有方法名
+	handler := spanNamed(t, spans, "GET /api/v1/vod/:id")
+	spanNamed(t, spans, "GET")
+
+	// 沿用上游传入的 trace id
+	if got := handler.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("trace id = %s, want %s", got, traceID)
+	}
+	child := spanNamed(t, spans, "source.fetch")
+	if child.Parent().SpanID() != handler.SpanContext().SpanID() {
+		t.Error("span started in the handler is not a child of the request span")
+	}
+}
+
+func TestEndRecordsError(t *testing.T) {
+	recorder := recordSpans(t)
+
+	_, ok := Start(context.Background(), "ok")
+	End(ok, nil)
+	_, failed := Start(context.Background(), "failed")
+	End(failed, errors.New("请求失败"))
+
+	spans := recorder.Ended()
+	if s := spanNamed(t, spans, "ok"); s.Status().Code != codes.Unset {
+		t.Errorf("ok status = %v", s.Status())
+	}
+	s := spanNamed(t, spans, "failed")
+	if s.Status().Code != codes.Error || s.Status().Description != "请求失败" {
+		t.Errorf("failed status = %v", s.Status())
+	}
+	if len(s.Events()) != 1 || s.Events()[0].Name != "exception" {
+		t.Errorf("failed events = %v", s.Events())
+	}
+}
+
+func TestLogHook(t *testing.T) {
+	recordSpans(t)
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf).Hook(LogHook{})
+
+	ctx, span := Start(context.Background(), "search")
+	defer span.End()
+	logger.Info().Ctx(ctx).Msg("with span")
+	logger.Info().Ctx(context.Background()).Msg("without span")
+	logger.Info().Msg("without ctx")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("got %d log lines", len(lines))
+	}
+	var first map[string]any
+	json.Unmarshal(lines[0], &first)
+	if first["trace_id"] != span.SpanContext().TraceID().String() || first["span_id"] != span.SpanContext().SpanID().String() {
+		t.Errorf("log with span = %s", lines[0])
+	}
+	for _, line := range lines[1:] {
+		if bytes.Contains(line, []byte("trace_id")) {
+			t.Errorf("log without span has trace_id: %s", line)
+		}
+	}
+}
+
+func TestInitExporter(t *testing.T) {
+	shutdown, err := Init(Config{Exporter: "none"})
+	if err != nil || shutdown(context.Background()) != nil {
+		t.Errorf("none: err = %v", err)
+	}
+	if _, err := Init(Config{Exporter: "jaeger"}); err == nil {
+		t.Error("unknown exporter accepted")
+	}
+}
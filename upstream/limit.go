@@ -0,0 +1,191 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"tv/metrics"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+// 收到 429 但没有 Retry-After 时的退避时间，连续出现时翻倍
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// Limit 单个上游主机的令牌桶限速
+type Limit struct {
+	Rate  float64 // 每秒请求数，0 表示不限速
+	Burst int     // 允许的突发请求数，小于 1 时按 1 处理
+}
+
+// LimitError 排队等待超过 max_wait，请求没有发出
+type LimitError struct {
+	Host string
+	Wait time.Duration // 还需要等待的时间
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("上游 %s 请求过于频繁，需等待 %s", e.Host, e.Wait.Round(100*time.Millisecond))
+}
+
+// 单个主机的限速状态
+type hostState struct {
+	limiter      *rate.Limiter
+	blockedUntil time.Time     // 429 / Retry-After 要求暂停到该时间
+	backoff      time.Duration // 最近一次退避时间
+}
+
+var (
+	mu       sync.Mutex
+	hosts    = make(map[string]*hostState)
+	limits   = make(map[string]Limit) // 按主机单独配置的限速
+	fallback Limit                    // 未单独配置的主机
+	maxWait  = 5 * time.Second
+)
+
+// Configure 设置各主机的限速，热加载时重复调用，已有主机保留令牌和退避状态
+func Configure(hostLimits map[string]Limit, defaultLimit Limit, wait time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	limits = hostLimits
+	fallback = defaultLimit
+	maxWait = wait
+	for host, st := range hosts {
+		l := limitOf(host)
+		st.limiter.SetLimit(rateOf(l))
+		st.limiter.SetBurst(burstOf(l))
+	}
+}
+
+// 需持有 mu
+func limitOf(host string) Limit {
+	if l, ok := limits[host]; ok {
+		return l
+	}
+	return fallback
+}
+
+func rateOf(l Limit) rate.Limit {
+	if l.Rate <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(l.Rate)
+}
+
+func burstOf(l Limit) int {
+	return max(l.Burst, 1)
+}
+
+func stateOf(host string) *hostState {
+	mu.Lock()
+	defer mu.Unlock()
+	st, ok := hosts[host]
+	if !ok {
+		l := limitOf(host)
+		st = &hostState{limiter: rate.NewLimiter(rateOf(l), burstOf(l))}
+		hosts[host] = st
+	}
+	return st
+}
+
+// Wait 等待发出请求的许可：先等待 429 要求的暂停时间，再从令牌桶取令牌
+// 总等待时间超过 max_wait 时不再排队，直接返回 LimitError
+func Wait(ctx context.Context, host string) error {
+	st := stateOf(host)
+
+	mu.Lock()
+	deadline := time.Now().Add(maxWait)
+	blockedUntil := st.blockedUntil
+	mu.Unlock()
+
+	if blockedUntil.After(deadline) {
+		metrics.UpstreamThrottled(host, "retry_after")
+		return &LimitError{Host: host, Wait: time.Until(blockedUntil)}
+	}
+	if d := time.Until(blockedUntil); d > 0 {
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	waitCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	if err := st.limiter.Wait(waitCtx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// 令牌桶判断在截止时间前拿不到令牌时立即返回
+		metrics.UpstreamThrottled(host, "queue_timeout")
+		return &LimitError{Host: host, Wait: maxWait}
+	}
+	return nil
+}
+
+// Observe 根据响应更新主机状态：429（或带 Retry-After 的 503）时暂停请求，成功后重置退避
+func Observe(host string, resp *http.Response) {
+	st := stateOf(host)
+	retryAfter, hasRetryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+
+	throttled := resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusServiceUnavailable && hasRetryAfter)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !throttled {
+		if resp.StatusCode < 400 {
+			st.backoff = 0
+		}
+		return
+	}
+
+	wait := retryAfter
+	if !hasRetryAfter {
+		st.backoff = min(max(st.backoff*2, minBackoff), maxBackoff)
+		wait = st.backoff
+	}
+	until := time.Now().Add(wait)
+	if until.After(st.blockedUntil) {
+		st.blockedUntil = until
+	}
+
+	metrics.UpstreamThrottled(host, "429")
+	log.Warn().
+		Str("host", host).
+		Int("status", resp.StatusCode).
+		Bool("retry_after", hasRetryAfter).
+		Dur("wait", wait).
+		Msg("上游要求降低请求频率，暂停请求")
+}
+
+// 解析 Retry-After：秒数或 HTTP 日期
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// IsLimited 错误是否由限速引起（本地排队超时）
+func IsLimited(err error) bool {
+	var limitErr *LimitError
+	return errors.As(err, &limitErr)
+}
@@ -0,0 +1,191 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// 重置限速状态，测试结束后恢复为不限速
+func resetLimits(t *testing.T, hostLimits map[string]Limit, wait time.Duration) {
+	t.Helper()
+	reset := func() {
+		mu.Lock()
+		hosts = make(map[string]*hostState)
+		mu.Unlock()
+	}
+	reset()
+	Configure(hostLimits, Limit{}, wait)
+	t.Cleanup(func() {
+		reset()
+		Configure(nil, Limit{}, 5*time.Second)
+	})
+}
+
+func response(status int, retryAfter string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: make(http.Header)}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return resp
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"0", 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Mon, 01 Jan 2024 00:00:30 GMT", 30 * time.Second, true},
+		{"Sun, 31 Dec 2023 23:59:00 GMT", 0, true}, // 过去的时间不等待
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %v, want %s, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWaitSpacesRequests(t *testing.T) {
+	resetLimits(t, map[string]Limit{"a.example.com": {Rate: 20, Burst: 1}}, 5*time.Second)
+
+	start := time.Now()
+	for range 3 {
+		if err := Wait(context.Background(), "a.example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 突发 1 个，之后每 50ms 一个
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 requests took %s, want >= 100ms", elapsed)
+	}
+
+	// 未单独配置的主机使用默认值（不限速）
+	start = time.Now()
+	for range 10 {
+		if err := Wait(context.Background(), "b.example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("unlimited host took %s", elapsed)
+	}
+}
+
+func TestWaitQueueTimeout(t *testing.T) {
+	resetLimits(t, map[string]Limit{"a.example.com": {Rate: 1, Burst: 1}}, 100*time.Millisecond)
+
+	if err := Wait(context.Background(), "a.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err := Wait(context.Background(), "a.example.com")
+	if !IsLimited(err) {
+		t.Fatalf("err = %v, want LimitError", err)
+	}
+	// 令牌桶判断等不到令牌时立即返回，不会等满 max_wait
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("queue timeout took %s", elapsed)
+	}
+	if IsLimited(context.Canceled) {
+		t.Error("context.Canceled reported as limited")
+	}
+}
+
+func TestConfigureUpdatesExistingHosts(t *testing.T) {
+	resetLimits(t, map[string]Limit{"a.example.com": {Rate: 1, Burst: 1}}, 100*time.Millisecond)
+
+	if err := Wait(context.Background(), "a.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	// 热加载放宽限速后立即生效
+	Configure(nil, Limit{}, 100*time.Millisecond)
+	if err := Wait(context.Background(), "a.example.com"); err != nil {
+		t.Errorf("err after reload = %v", err)
+	}
+}
+
+func TestObserveRetryAfter(t *testing.T) {
+	resetLimits(t, nil, time.Second)
+
+	Observe("a.example.com", response(http.StatusTooManyRequests, "120"))
+	err := Wait(context.Background(), "a.example.com")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("err = %v, want LimitError", err)
+	}
+	if limitErr.Host != "a.example.com" || limitErr.Wait < 119*time.Second || limitErr.Wait > 120*time.Second {
+		t.Errorf("LimitError = %+v", limitErr)
+	}
+
+	// 503 仅在带 Retry-After 时视为限速
+	Observe("b.example.com", response(http.StatusServiceUnavailable, ""))
+	if err := Wait(context.Background(), "b.example.com"); err != nil {
+		t.Errorf("503 without Retry-After: err = %v", err)
+	}
+	Observe("b.example.com", response(http.StatusServiceUnavailable, "120"))
+	if err := Wait(context.Background(), "b.example.com"); !IsLimited(err) {
+		t.Errorf("503 with Retry-After: err = %v", err)
+	}
+}
+
+func TestObserveRetryAfterWaits(t *testing.T) {
+	resetLimits(t, nil, 5*time.Second)
+
+	Observe("a.example.com", response(http.StatusTooManyRequests, "0"))
+	if err := Wait(context.Background(), "a.example.com"); err != nil {
+		t.Fatalf("Retry-After 0: err = %v", err)
+	}
+
+	// 暂停时间在 max_wait 内时排队等待，等待期间可被取消
+	Observe("a.example.com", response(http.StatusTooManyRequests, "2"))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Wait(ctx, "a.example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestObserveBackoff(t *testing.T) {
+	resetLimits(t, nil, 5*time.Second)
+	st := stateOf("a.example.com")
+	backoff := func() time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		return st.backoff
+	}
+
+	// 没有 Retry-After 时从 1s 开始，连续出现时翻倍，最多 1 分钟
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	for _, w := range want {
+		Observe("a.example.com", response(http.StatusTooManyRequests, ""))
+		if got := backoff(); got != w {
+			t.Fatalf("backoff = %s, want %s", got, w)
+		}
+	}
+	for range 10 {
+		Observe("a.example.com", response(http.StatusTooManyRequests, ""))
+	}
+	if got := backoff(); got != maxBackoff {
+		t.Errorf("backoff = %s, want %s", got, maxBackoff)
+	}
+
+	// 错误响应不重置退避，成功响应重置
+	Observe("a.example.com", response(http.StatusInternalServerError, ""))
+	if backoff() == 0 {
+		t.Error("backoff reset by 500")
+	}
+	Observe("a.example.com", response(http.StatusOK, ""))
+	if got := backoff(); got != 0 {
+		t.Errorf("backoff after 200 = %s, want 0", got)
+	}
+}
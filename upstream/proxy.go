@@ -0,0 +1,102 @@
+package upstream
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Direct 不使用代理（包括环境变量中的代理）
+const Direct = "direct"
+
+var (
+	proxyMu      sync.RWMutex
+	proxies      = make(map[string]*url.URL) // 按主机单独配置的代理，nil 表示直连
+	defaultProxy = http.ProxyFromEnvironment // 未单独配置的主机
+)
+
+// 访问上游共用的底层 Transport，按请求的主机选择代理
+var base = newBase()
+
+func newBase() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = proxyFor
+	return t
+}
+
+// ConfigureProxies 设置各主机使用的代理，fallback 为空时使用环境变量 HTTP_PROXY / HTTPS_PROXY
+// 支持 http / https / socks5 / socks5h 代理，认证信息写在地址中，Direct 表示直连
+func ConfigureProxies(hostProxies map[string]string, fallback string) error {
+	parsed := make(map[string]*url.URL, len(hostProxies))
+	for host, raw := range hostProxies {
+		u, err := parseProxy(raw)
+		if err != nil {
+			return err
+		}
+		parsed[host] = u
+	}
+	def := http.ProxyFromEnvironment
+	if fallback != "" {
+		u, err := parseProxy(fallback)
+		if err != nil {
+			return err
+		}
+		def = http.ProxyURL(u)
+	}
+
+	proxyMu.Lock()
+	proxies = parsed
+	defaultProxy = def
+	proxyMu.Unlock()
+
+	// 代理变更后旧连接不再复用
+	base.CloseIdleConnections()
+
+	if len(parsed) > 0 || fallback != "" {
+		hosts := make([]string, 0, len(parsed))
+		for host, u := range parsed {
+			hosts = append(hosts, host+"="+redacted(u))
+		}
+		sort.Strings(hosts)
+		event := log.Info().Strs("hosts", hosts)
+		if fallback != "" {
+			u, _ := parseProxy(fallback)
+			event = event.Str("default", redacted(u))
+		}
+		event.Msg("上游代理已设置")
+	}
+	return nil
+}
+
+func proxyFor(req *http.Request) (*url.URL, error) {
+	proxyMu.RLock()
+	defer proxyMu.RUnlock()
+	if u, ok := proxies[req.URL.Host]; ok {
+		return u, nil
+	}
+	return defaultProxy(req)
+}
+
+// 解析代理地址，Direct 返回 nil
+func parseProxy(raw string) (*url.URL, error) {
+	if raw == Direct {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("代理地址格式错误: %w", err)
+	}
+	return u, nil
+}
+
+// 隐藏代理地址中的密码
+func redacted(u *url.URL) string {
+	if u == nil {
+		return Direct
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,25 @@
+package upstream
+
+import "net/http"
+
+// Transport 访问视频源、豆瓣和 Omo 使用的 Transport：按主机限速，并按配置走代理
+func Transport() http.RoundTripper {
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if err := Wait(req.Context(), host); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	Observe(host, resp)
+	return resp, nil
+}
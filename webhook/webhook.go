@@ -0,0 +1,257 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+	"tv/conf"
+	"tv/models"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// 事件类型
+const (
+	EventFollowUpdate   = "follow.update"
+	EventSourceDown     = "source.down"
+	EventSourceUp       = "source.up"
+	EventCacheCleared   = "cache.cleared"
+	EventConfigReloaded = "config.reloaded"
+	EventPing           = "ping"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+	maxDeliveries  = 200
+)
+
+var (
+	instance *Dispatcher
+	once     sync.Once
+)
+
+func GetDispatcher() *Dispatcher {
+	once.Do(func() {
+		instance = newDispatcher()
+	})
+	return instance
+}
+
+func newDispatcher() *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		client: resty.New().
+			SetHeader("User-Agent", "YTV-Webhook/1.0").
+			SetHeader("Content-Type", "application/json"),
+		ctx:        ctx,
+		cancel:     cancel,
+		deliveries: make([]Delivery, 0, maxDeliveries),
+	}
+}
+
+// 推送内容
+type Payload struct {
+	ID        string `json:"id"`
+	Event     string `json:"event"`
+	Timestamp int64  `json:"timestamp"`
+	Data      any    `json:"data"`
+}
+
+// 推送记录
+type Delivery struct {
+	ID         string `json:"id"`
+	Webhook    string `json:"webhook"`
+	Event      string `json:"event"`
+	URL        string `json:"url"`
+	Attempts   int    `json:"attempts"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Success    bool   `json:"success"`
+	CreatedAt  int64  `json:"created_at"`
+	Duration   int64  `json:"duration_ms"`
+}
+
+// Dispatcher 向配置的 Webhook 推送事件，失败时按指数退避重试
+type Dispatcher struct {
+	client *resty.Client
+	ctx    context.Context // 服务退出时取消，停止进行中的推送和重试
+	cancel context.CancelFunc
+
+	mu         sync.RWMutex
+	deliveries []Delivery // 最新在前
+}
+
+// Emit 异步向所有订阅了该事件的 Webhook 推送
+func Emit(event string, data any) {
+	d := GetDispatcher()
+	for _, hook := range conf.Get().Webhooks {
+		if !hook.Subscribes(event) {
+			continue
+		}
+		go d.Send(hook, event, data)
+	}
+}
+
+// Send 同步推送一次事件（包含重试），返回推送记录
+func (d *Dispatcher) Send(hook models.Webhook, event string, data any) Delivery {
+	start := time.Now()
+	payload := Payload{
+		ID:        newID(),
+		Event:     event,
+		Timestamp: start.UnixMilli(),
+		Data:      data,
+	}
+	delivery := Delivery{
+		ID:        payload.ID,
+		Webhook:   hook.Name,
+		Event:     event,
+		URL:       hook.URL,
+		CreatedAt: payload.Timestamp,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		delivery.Error = fmt.Sprintf("序列化失败: %v", err)
+		d.record(delivery)
+		return delivery
+	}
+
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	backoff := time.Second
+	for attempt := 0; attempt <= hook.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if !d.wait(backoff) {
+				log.Warn().
+					Str("webhook", hook.Name).
+					Str("event", event).
+					Int("attempts", delivery.Attempts).
+					Msg("服务正在退出，停止重试 Webhook")
+				break
+			}
+			backoff *= 2
+		}
+		delivery.Attempts = attempt + 1
+
+		status, err := d.post(hook, payload, body, timeout)
+		delivery.StatusCode = status
+		if err == nil {
+			delivery.Success = true
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+
+		log.Warn().
+			Str("webhook", hook.Name).
+			Str("event", event).
+			Int("attempt", delivery.Attempts).
+			Err(err).
+			Msg("Webhook 推送失败")
+
+		// 4xx（除 429 外）说明请求本身有问题，重试无意义
+		if status >= 400 && status < 500 && status != 429 {
+			break
+		}
+	}
+	delivery.Duration = time.Since(start).Milliseconds()
+
+	log.Info().
+		Str("webhook", hook.Name).
+		Str("event", event).
+		Str("delivery", delivery.ID).
+		Bool("success", delivery.Success).
+		Int("attempts", delivery.Attempts).
+		Int64("duration_ms", delivery.Duration).
+		Msg("Webhook 推送完成")
+
+	d.record(delivery)
+	return delivery
+}
+
+// 等待重试间隔，服务退出时提前返回 false
+func (d *Dispatcher) wait(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-d.ctx.Done():
+		return false
+	}
+}
+
+// Close 取消进行中的推送，等待重试的推送不再重试
+func (d *Dispatcher) Close() {
+	d.cancel()
+}
+
+func (d *Dispatcher) post(hook models.Webhook, payload Payload, body []byte, timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, timeout)
+	defer cancel()
+
+	timestamp := strconv.FormatInt(payload.Timestamp, 10)
+	resp, err := d.client.R().
+		SetHeader("X-YTV-Event", payload.Event).
+		SetHeader("X-YTV-Delivery", payload.ID).
+		SetHeader("X-YTV-Timestamp", timestamp).
+		SetHeader("X-YTV-Signature", "sha256="+Sign(hook.Secret, timestamp, body)).
+		SetBody(body).
+		SetContext(ctx).
+		Post(hook.URL)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return resp.StatusCode(), fmt.Errorf("HTTP 状态码 %d", resp.StatusCode())
+	}
+	return resp.StatusCode(), nil
+}
+
+// Deliveries 返回最近的推送记录
+func (d *Dispatcher) Deliveries() []Delivery {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	list := make([]Delivery, len(d.deliveries))
+	copy(list, d.deliveries)
+	return list
+}
+
+func (d *Dispatcher) record(delivery Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.deliveries = append([]Delivery{delivery}, d.deliveries...)
+	if len(d.deliveries) > maxDeliveries {
+		d.deliveries = d.deliveries[:maxDeliveries]
+	}
+}
+
+// Sign 计算推送签名（HMAC-SHA256，十六进制），签名内容为 "时间戳.请求体"
+// 时间戳一并签名，接收方校验时间戳在允许范围内即可拒绝重放的旧请求
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tv/models"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"test"}`)
+	want := "2c82342591b794f4be1db9d02c60655f4a30211b7159de41211ef7d3b948c860"
+	if got := Sign("change-me", "1700000000000", body); got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+
+	// 时间戳、请求体或密钥任一不同，签名都不同
+	if Sign("change-me", "1700000000001", body) == want {
+		t.Error("签名未覆盖时间戳")
+	}
+	if Sign("change-me", "1700000000000", []byte(`{"event":"other"}`)) == want {
+		t.Error("签名未覆盖请求体")
+	}
+	if Sign("other", "1700000000000", body) == want {
+		t.Error("签名未使用密钥")
+	}
+}
+
+func TestSendSignsTimestamp(t *testing.T) {
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	d := GetDispatcher()
+	delivery := d.Send(models.Webhook{Name: "test", URL: srv.URL, Secret: "s3cret"}, "test.event", map[string]string{"k": "v"})
+	if !delivery.Success {
+		t.Fatalf("推送失败: %+v", delivery)
+	}
+
+	timestamp := header.Get("X-YTV-Timestamp")
+	if timestamp == "" {
+		t.Fatal("缺少 X-YTV-Timestamp")
+	}
+	if got, want := header.Get("X-YTV-Signature"), "sha256="+Sign("s3cret", timestamp, body); got != want {
+		t.Errorf("X-YTV-Signature = %s, want %s", got, want)
+	}
+	if header.Get("X-YTV-Delivery") != delivery.ID {
+		t.Errorf("X-YTV-Delivery = %s, want %s", header.Get("X-YTV-Delivery"), delivery.ID)
+	}
+}
+
+func TestCloseStopsRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	d := newDispatcher()
+	done := make(chan Delivery, 1)
+	go func() {
+		done <- d.Send(models.Webhook{Name: "test", URL: srv.URL, MaxRetries: 5}, "test.event", nil)
+	}()
+
+	// 第一次推送失败后进入 1 秒的重试等待，此时退出
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	d.Close()
+
+	select {
+	case delivery := <-done:
+		if delivery.Success || delivery.Attempts != 1 {
+			t.Errorf("delivery = %+v, want one failed attempt", delivery)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Close did not interrupt the retry backoff")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("server received %d requests, want 1", calls.Load())
+	}
+}